@@ -20,6 +20,25 @@ type AppConfig struct {
 	DBPassword          string
 	DBName              string
 	SSLMode             string
+	TrashRetentionDays  int
+	TrashPurgeMinutes   int
+	BatchMaxOperations  int
+	BatchRatePerMinute  int
+	ScrubIntervalMins   int
+	PreviewTextLines    int
+	ClamdAddress        string
+	ScanTimeoutSeconds  int
+	ScanFailOpen        bool
+	ContentPolicyFile   string
+	DedupSecret         string
+	RetentionMinutes    int
+	SecureOverwrite     bool
+	LockDefaultMinutes  int
+	LockMaxMinutes      int
+	MetadataSecret      string
+	FileRequestSecret   string
+	ShareAccessDays     int
+	AccessPruneMinutes  int
 }
 
 var C AppConfig
@@ -28,10 +47,12 @@ var C AppConfig
 func Load() {
 	_ = godotenv.Load() // load .env if present
 
+	jwtSecret := getEnv("JWT_SECRET", "change_me")
+	secrets := map[string]string{jwtSecret: "JWT_SECRET"}
 	C = AppConfig{
 		AppEnv:              getEnv("APP_ENV", "development"),
 		AppPort:             getEnv("APP_PORT", "8080"),
-		JWTSecret:           getEnv("JWT_SECRET", "change_me"),
+		JWTSecret:           jwtSecret,
 		TokenExpiresInHours: getEnvAsInt("TOKEN_EXPIRES_IN_HOURS", 24),
 		DBHost:              getEnv("DB_HOST", "localhost"),
 		DBPort:              getEnv("DB_PORT", "5432"),
@@ -39,6 +60,25 @@ func Load() {
 		DBPassword:          getEnv("DB_PASSWORD", "postgres"),
 		DBName:              getEnv("DB_NAME", "fiber_auth"),
 		SSLMode:             getEnv("SSL_MODE", "disable"),
+		TrashRetentionDays:  getEnvAsInt("TRASH_RETENTION_DAYS", 30),
+		TrashPurgeMinutes:   getEnvAsInt("TRASH_PURGE_INTERVAL_MINUTES", 60),
+		BatchMaxOperations:  getEnvAsInt("BATCH_MAX_OPERATIONS", 100),
+		BatchRatePerMinute:  getEnvAsInt("BATCH_RATE_PER_MINUTE", 10),
+		ScrubIntervalMins:   getEnvAsInt("SCRUB_INTERVAL_MINUTES", 1440),
+		PreviewTextLines:    getEnvAsInt("PREVIEW_TEXT_LINES", 20),
+		ClamdAddress:        getEnv("CLAMD_ADDRESS", ""),
+		ScanTimeoutSeconds:  getEnvAsInt("SCAN_TIMEOUT_SECONDS", 60),
+		ScanFailOpen:        getEnvAsBool("SCAN_FAIL_OPEN", false),
+		ContentPolicyFile:   getEnv("CONTENT_POLICY_FILE", ""),
+		DedupSecret:         getSecret("DEDUP_SECRET", secrets),
+		RetentionMinutes:    getEnvAsInt("RETENTION_INTERVAL_MINUTES", 60),
+		SecureOverwrite:     getEnvAsBool("SECURE_OVERWRITE", false),
+		LockDefaultMinutes:  getEnvAsInt("LOCK_DEFAULT_MINUTES", 30),
+		LockMaxMinutes:      getEnvAsInt("LOCK_MAX_MINUTES", 480),
+		MetadataSecret:      getSecret("METADATA_SECRET", secrets),
+		FileRequestSecret:   getSecret("FILE_REQUEST_SECRET", secrets),
+		ShareAccessDays:     getEnvAsInt("SHARE_ACCESS_RETENTION_DAYS", 90),
+		AccessPruneMinutes:  getEnvAsInt("SHARE_ACCESS_PRUNE_INTERVAL_MINUTES", 60),
 	}
 
 	log.Printf("config loaded: env=%s port=%s db=%s@%s:%s/%s", C.AppEnv, C.AppPort, C.DBUser, C.DBHost, C.DBPort, C.DBName)
@@ -51,6 +91,21 @@ func getEnv(key, fallback string) string {
 	return fallback
 }
 
+// getSecret reads a secret that has to be set explicitly. Every secret protects one thing only, so it may
+// not repeat JWT_SECRET or another secret: leaking one must not expose what the others protect.
+// seen maps the secrets read so far to their variable names.
+func getSecret(key string, seen map[string]string) string {
+	v := os.Getenv(key)
+	if v == "" {
+		log.Fatalf("config: %s must be set", key)
+	}
+	if other, ok := seen[v]; ok {
+		log.Fatalf("config: %s must differ from %s", key, other)
+	}
+	seen[v] = key
+	return v
+}
+
 func getEnvAsInt(key string, fallback int) int {
 	if v := os.Getenv(key); v != "" {
 		if i, err := strconv.Atoi(v); err == nil {
@@ -59,3 +114,12 @@ func getEnvAsInt(key string, fallback int) int {
 	}
 	return fallback
 }
+
+func getEnvAsBool(key string, fallback bool) bool {
+	if v := os.Getenv(key); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b
+		}
+	}
+	return fallback
+}
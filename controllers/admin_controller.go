@@ -0,0 +1,49 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+
+	"file_project/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type AdminController struct {
+	Scrubber *services.ScrubService
+}
+
+// Integrity reports the last scrub pass, blob counts per integrity state and every flagged blob
+func (ac *AdminController) Integrity(c *fiber.Ctx) error {
+	counts, err := ac.Scrubber.Counts()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	flagged, err := ac.Scrubber.Flagged()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	flaggedPreviews, err := ac.Scrubber.FlaggedPreviews()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{
+		"last_run":         ac.Scrubber.LastReport(),
+		"counts":           counts,
+		"flagged":          flagged,
+		"flagged_previews": flaggedPreviews,
+	})
+}
+
+// Scrub starts a scrub pass in the background
+func (ac *AdminController) Scrub(c *fiber.Ctx) error {
+	if ac.Scrubber.Running() {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": services.ErrScrubRunning.Error()})
+	}
+	go func() {
+		if _, err := ac.Scrubber.Run(); err != nil && !errors.Is(err, services.ErrScrubRunning) {
+			log.Printf("scrub failed: %v", err)
+		}
+	}()
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{"status": "started"})
+}
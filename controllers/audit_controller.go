@@ -0,0 +1,24 @@
+package controllers
+
+import (
+	"file_project/repositories"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const auditPageSize = 200
+
+type AuditController struct {
+	Audit repositories.AuditRepository
+}
+
+// List returns the most recent audit entries concerning the current user's data
+func (ac *AuditController) List(c *fiber.Ctx) error {
+	ownerIDAny := c.Locals("user_id")
+	ownerID, _ := ownerIDAny.(uint)
+	list, err := ac.Audit.ListByUser(ownerID, auditPageSize)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(list)
+}
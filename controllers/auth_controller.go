@@ -56,12 +56,12 @@ func (a *AuthController) Register(c *fiber.Ctx) error {
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not hash password"})
 	}
-	user := models.User{Name: body.Name, Email: body.Email, Password: hash}
+	user := models.User{Name: body.Name, Email: body.Email, Password: hash, Role: models.RoleUser}
 	if err := a.Users.Create(&user); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to create user"})
 	}
 
-	token, err := utils.GenerateJWT(user.ID, user.Email, user.Name)
+	token, err := utils.GenerateJWT(user.ID, user.Email, user.Name, user.Role)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to generate token"})
 	}
@@ -85,7 +85,7 @@ func (a *AuthController) Login(c *fiber.Ctx) error {
 	if !utils.CheckPasswordHash(user.Password, body.Password) {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid credentials"})
 	}
-	token, err := utils.GenerateJWT(user.ID, user.Email, user.Name)
+	token, err := utils.GenerateJWT(user.ID, user.Email, user.Name, user.Role)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to generate token"})
 	}
@@ -97,5 +97,6 @@ func (a *AuthController) Me(c *fiber.Ctx) error {
 		"name":    c.Locals("name"),
 		"user_id": c.Locals("user_id"),
 		"email":   c.Locals("email"),
+		"role":    c.Locals("role"),
 	})
 }
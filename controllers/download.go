@@ -0,0 +1,82 @@
+package controllers
+
+import (
+	"errors"
+	"io"
+	"net/url"
+
+	"file_project/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// sendPlaintext streams a decrypted file to the client with its detected content type.
+// Inline disposition is only honoured for types that browsers cannot execute.
+func sendPlaintext(c *fiber.Ctx, r io.ReadCloser, filename, mimeType string, size int64) error {
+	contentType := services.ContentTypeFor(mimeType, filename)
+	disposition := "attachment"
+	if c.QueryBool("inline") && services.IsInlineSafe(contentType) {
+		disposition = "inline"
+	}
+	c.Set("Content-Type", contentType)
+	c.Set("X-Content-Type-Options", "nosniff")
+	c.Set("Content-Disposition", disposition+"; filename=\""+url.QueryEscape(filename)+"\"")
+	if size <= 0 {
+		size = -1
+	}
+	return c.SendStream(r, int(size))
+}
+
+// errIncomplete is reported for a download the client did not receive in full
+var errIncomplete = errors.New("download incomplete")
+
+// downloadDone is told how a streamed download ended: err is nil once everything was sent.
+// sent is the number of bytes written to the response.
+type downloadDone func(err error, sent int64)
+
+// completionReader reports through done, when the response stream is closed, whether the
+// whole plaintext was read: size bytes, or up to EOF when the size is unknown.
+type completionReader struct {
+	r    io.ReadCloser
+	size int64
+	read int64
+	eof  bool
+	done downloadDone
+}
+
+func trackCompletion(r io.ReadCloser, size int64, done downloadDone) io.ReadCloser {
+	return &completionReader{r: r, size: size, done: done}
+}
+
+func (cr *completionReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.read += int64(n)
+	if err == io.EOF {
+		cr.eof = true
+	}
+	return n, err
+}
+
+func (cr *completionReader) Close() error {
+	if cr.done != nil {
+		var err error
+		if !cr.eof && (cr.size <= 0 || cr.read < cr.size) {
+			err = errIncomplete
+		}
+		cr.done(err, cr.read)
+		cr.done = nil
+	}
+	return cr.r.Close()
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
@@ -1,16 +1,29 @@
 package controllers
 
 import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
+	"file_project/config"
+	"file_project/models"
 	"file_project/services"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 type FileController struct {
-	Files *services.FileService
+	Files     *services.FileService
+	Batches   *services.BatchService
+	Retention *services.RetentionService
 }
 
 func (fc *FileController) Upload(c *fiber.Ctx) error {
@@ -24,17 +37,87 @@ func (fc *FileController) Upload(c *fiber.Ctx) error {
 	}
 	ownerIDAny := c.Locals("user_id")
 	ownerID, _ := ownerIDAny.(uint)
-	meta, err := fc.Files.SaveAndEncrypt(ownerID, file, password)
+	opts := uploadOptions(c)
+	if v := c.FormValue("expires_at"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil || !t.After(time.Now()) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "expires_at must be a future RFC 3339 time"})
+		}
+		opts.ExpiresAt = &t
+	}
+	opts.Description = c.FormValue("description")
+	if v := c.FormValue("properties"); v != "" {
+		if err := json.Unmarshal([]byte(v), &opts.Properties); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "properties must be a JSON object of strings"})
+		}
+	}
+	meta, err := fc.Files.SaveAndEncrypt(ownerID, file, password, opts)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return uploadError(c, err)
 	}
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
-		"id":       meta.ID,
-		"filename": meta.Filename,
-		"size":     meta.Size,
+		"id":            meta.ID,
+		"filename":      meta.Filename,
+		"size":          meta.Size,
+		"original_size": meta.OriginalSize,
+		"mime_type":     meta.MimeType,
+		"sha256":        meta.SHA256,
+		"scan_status":   meta.ScanStatus,
+		"expires_at":    meta.ExpiresAt,
+		"description":   meta.Description,
+		"properties":    meta.Properties,
+	})
+}
+
+// uploadError maps ingest failures (content policy, scanner) to HTTP responses
+func uploadError(c *fiber.Ctx, err error) error {
+	var pv *services.PolicyViolation
+	var le *services.LockedError
+	switch {
+	case errors.As(err, &pv):
+		status := fiber.StatusUnsupportedMediaType
+		if pv.Code == services.PolicyTooLarge {
+			status = fiber.StatusRequestEntityTooLarge
+		}
+		return c.Status(status).JSON(fiber.Map{"error": pv.Message, "code": pv.Code})
+	case errors.Is(err, services.ErrLegalHold):
+		return legalHold(c)
+	case errors.As(err, &le):
+		return locked(c, le)
+	case errors.Is(err, services.ErrNotPermitted):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, services.ErrVersionConflict):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidMetadata):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, services.ErrScanUnavailable):
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"error": err.Error(), "code": "scanner_unavailable"})
+	default:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+}
+
+// legalHold answers a request that would modify or delete a held file
+func legalHold(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": services.ErrLegalHold.Error(), "code": "legal_hold"})
+}
+
+// locked answers a write on a file another user has checked out
+func locked(c *fiber.Ctx, le *services.LockedError) error {
+	return c.Status(fiber.StatusLocked).JSON(fiber.Map{
+		"error":      le.Error(),
+		"code":       "locked",
+		"locked_by":  le.Lock.UserID,
+		"expires_at": le.Lock.ExpiresAt,
 	})
 }
 
+// uploadOptions reads the optional upload form fields
+func uploadOptions(c *fiber.Ctx) services.UploadOptions {
+	preview, _ := strconv.ParseBool(c.FormValue("preview"))
+	return services.UploadOptions{Preview: preview}
+}
+
 func (fc *FileController) Download(c *fiber.Ctx) error {
 	idStr := c.Params("id")
 	pwd := c.Query("password")
@@ -47,13 +130,14 @@ func (fc *FileController) Download(c *fiber.Ctx) error {
 	}
 	ownerIDAny := c.Locals("user_id")
 	ownerID, _ := ownerIDAny.(uint)
-	plain, filename, err := fc.Files.DecryptAndRead(ownerID, id, pwd)
+	r, meta, err := fc.Files.Open(ownerID, id, pwd)
+	if errors.Is(err, services.ErrQuarantined) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+	}
 	if err != nil {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid password or file not found"})
 	}
-	c.Set("Content-Type", "application/octet-stream")
-	c.Set("Content-Disposition", "attachment; filename=\""+url.QueryEscape(filename)+"\"")
-	return c.Send(plain)
+	return sendPlaintext(c, r, meta.Filename, meta.MimeType, meta.OriginalSize)
 }
 
 func (fc *FileController) ChangePassword(c *fiber.Ctx) error {
@@ -69,6 +153,13 @@ func (fc *FileController) ChangePassword(c *fiber.Ctx) error {
 	ownerIDAny := c.Locals("user_id")
 	ownerID, _ := ownerIDAny.(uint)
 	if err := fc.Files.ChangePassword(ownerID, id, body.OldPassword, body.NewPassword); err != nil {
+		if errors.Is(err, services.ErrLegalHold) {
+			return legalHold(c)
+		}
+		var le *services.LockedError
+		if errors.As(err, &le) {
+			return locked(c, le)
+		}
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid password or file not found"})
 	}
 	return c.JSON(fiber.Map{"status": "ok"})
@@ -82,17 +173,602 @@ func (fc *FileController) Delete(c *fiber.Ctx) error {
 	ownerIDAny := c.Locals("user_id")
 	ownerID, _ := ownerIDAny.(uint)
 	if err := fc.Files.Delete(ownerID, id); err != nil {
+		if errors.Is(err, services.ErrLegalHold) {
+			return legalHold(c)
+		}
+		var le *services.LockedError
+		if errors.As(err, &le) {
+			return locked(c, le)
+		}
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "file not found"})
 	}
-	return c.JSON(fiber.Map{"status": "deleted"})
+	return c.JSON(fiber.Map{"status": "trashed"})
 }
 
 func (fc *FileController) List(c *fiber.Ctx) error {
 	ownerIDAny := c.Locals("user_id")
 	ownerID, _ := ownerIDAny.(uint)
-	list, err := fc.Files.List(ownerID)
+	filter := services.MetadataFilter{Query: c.Query("q"), Properties: map[string]string{}}
+	c.Context().QueryArgs().VisitAll(func(k, v []byte) {
+		if name, ok := strings.CutPrefix(string(k), "property."); ok {
+			filter.Properties[name] = string(v)
+		}
+	})
+	list, err := fc.Files.List(ownerID, filter)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
 	return c.JSON(list)
 }
+
+// UploadVersion stores a new revision of an existing file
+func (fc *FileController) UploadVersion(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+	password := c.FormValue("password")
+	if len(password) < 6 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "password must be >= 6 chars"})
+	}
+	file, err := c.FormFile("file")
+	if err != nil || file == nil || file.Size == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "file is required"})
+	}
+	ownerIDAny := c.Locals("user_id")
+	ownerID, _ := ownerIDAny.(uint)
+	v, err := fc.Files.AddVersion(ownerID, id, file, password, uploadOptions(c))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "file not found"})
+		}
+		return uploadError(c, err)
+	}
+	return c.Status(fiber.StatusCreated).JSON(v)
+}
+
+func (fc *FileController) ListVersions(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+	ownerIDAny := c.Locals("user_id")
+	ownerID, _ := ownerIDAny.(uint)
+	list, err := fc.Files.ListVersions(ownerID, id)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "file not found"})
+	}
+	return c.JSON(list)
+}
+
+func (fc *FileController) DownloadVersion(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+	version, err := c.ParamsInt("version")
+	if err != nil || version < 1 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid version"})
+	}
+	pwd := c.Query("password")
+	if pwd == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "password required"})
+	}
+	ownerIDAny := c.Locals("user_id")
+	ownerID, _ := ownerIDAny.(uint)
+	r, meta, v, err := fc.Files.OpenVersion(ownerID, id, version, pwd)
+	if errors.Is(err, services.ErrQuarantined) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid password or version not found"})
+	}
+	return sendPlaintext(c, r, meta.Filename, v.MimeType, v.OriginalSize)
+}
+
+func (fc *FileController) RestoreVersion(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+	version, err := c.ParamsInt("version")
+	if err != nil || version < 1 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid version"})
+	}
+	ownerIDAny := c.Locals("user_id")
+	ownerID, _ := ownerIDAny.(uint)
+	v, err := fc.Files.RestoreVersion(ownerID, id, version)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "file or version not found"})
+		}
+		if errors.Is(err, services.ErrNotPermitted) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+		}
+		if errors.Is(err, services.ErrVersionConflict) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+		}
+		if errors.Is(err, services.ErrLegalHold) {
+			return legalHold(c)
+		}
+		var le *services.LockedError
+		if errors.As(err, &le) {
+			return locked(c, le)
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(v)
+}
+
+func (fc *FileController) GetVersionPolicy(c *fiber.Ctx) error {
+	ownerIDAny := c.Locals("user_id")
+	ownerID, _ := ownerIDAny.(uint)
+	p, err := fc.Files.GetVersionPolicy(ownerID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(p)
+}
+
+func (fc *FileController) SetVersionPolicy(c *fiber.Ctx) error {
+	type req struct {
+		KeepVersions int `json:"keep_versions"`
+		KeepDays     int `json:"keep_days"`
+	}
+	var body req
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
+	}
+	ownerIDAny := c.Locals("user_id")
+	ownerID, _ := ownerIDAny.(uint)
+	p, err := fc.Files.SetVersionPolicy(ownerID, body.KeepVersions, body.KeepDays)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(p)
+}
+
+// GetDedup reports whether deduplication is on and how much space it saves
+func (fc *FileController) GetDedup(c *fiber.Ctx) error {
+	ownerIDAny := c.Locals("user_id")
+	ownerID, _ := ownerIDAny.(uint)
+	st, err := fc.Files.GetDedup(ownerID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(st)
+}
+
+// SetDedup opts the user in to or out of deduplication for future uploads
+func (fc *FileController) SetDedup(c *fiber.Ctx) error {
+	type req struct {
+		Enabled *bool `json:"enabled"`
+	}
+	var body req
+	if err := c.BodyParser(&body); err != nil || body.Enabled == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "enabled required"})
+	}
+	ownerIDAny := c.Locals("user_id")
+	ownerID, _ := ownerIDAny.(uint)
+	st, err := fc.Files.SetDedup(ownerID, *body.Enabled)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(st)
+}
+
+func (fc *FileController) GetRetentionPolicy(c *fiber.Ctx) error {
+	ownerIDAny := c.Locals("user_id")
+	ownerID, _ := ownerIDAny.(uint)
+	p, err := fc.Retention.GetPolicy(ownerID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(p)
+}
+
+func (fc *FileController) SetRetentionPolicy(c *fiber.Ctx) error {
+	type req struct {
+		DeleteAfterDays int `json:"delete_after_days"`
+	}
+	var body req
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
+	}
+	ownerIDAny := c.Locals("user_id")
+	ownerID, _ := ownerIDAny.(uint)
+	p, err := fc.Retention.SetPolicy(ownerID, body.DeleteAfterDays)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(p)
+}
+
+// SetExpiry sets or clears (expires_at: null) a file's automatic expiry
+func (fc *FileController) SetExpiry(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+	type req struct {
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+	var body req
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
+	}
+	ownerIDAny := c.Locals("user_id")
+	ownerID, _ := ownerIDAny.(uint)
+	meta, err := fc.Files.SetExpiry(ownerID, id, body.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "file not found"})
+		}
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"id": meta.ID, "expires_at": meta.ExpiresAt})
+}
+
+// Lock checks the file out to the caller so nobody else can write it until the lock expires or is released
+func (fc *FileController) Lock(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+	type req struct {
+		DurationMinutes int `json:"duration_minutes"`
+	}
+	var body req
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
+		}
+	}
+	if body.DurationMinutes == 0 {
+		body.DurationMinutes = config.C.LockDefaultMinutes
+	}
+	if body.DurationMinutes < 1 || body.DurationMinutes > config.C.LockMaxMinutes {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("duration_minutes must be between 1 and %d", config.C.LockMaxMinutes)})
+	}
+	ownerIDAny := c.Locals("user_id")
+	ownerID, _ := ownerIDAny.(uint)
+	lock, err := fc.Files.Lock(ownerID, id, time.Duration(body.DurationMinutes)*time.Minute)
+	if err != nil {
+		var le *services.LockedError
+		if errors.As(err, &le) {
+			return locked(c, le)
+		}
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "file not found"})
+		}
+		if errors.Is(err, services.ErrNotPermitted) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(lock)
+}
+
+// GetLock reports who holds the file's lock; "locked" is false when nobody does
+func (fc *FileController) GetLock(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+	ownerIDAny := c.Locals("user_id")
+	ownerID, _ := ownerIDAny.(uint)
+	lock, err := fc.Files.GetLock(ownerID, id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "file not found"})
+		}
+		if errors.Is(err, services.ErrNotPermitted) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if lock == nil {
+		return c.JSON(fiber.Map{"locked": false})
+	}
+	return c.JSON(fiber.Map{"locked": true, "locked_by": lock.UserID, "expires_at": lock.ExpiresAt, "created_at": lock.CreatedAt})
+}
+
+// Unlock releases the caller's lock; admins may break anyone's lock with ?force=true
+func (fc *FileController) Unlock(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+	force := c.QueryBool("force")
+	if role, _ := c.Locals("role").(string); force && role != models.RoleAdmin {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "only admins can break locks"})
+	}
+	ownerIDAny := c.Locals("user_id")
+	ownerID, _ := ownerIDAny.(uint)
+	if err := fc.Files.Unlock(ownerID, id, force); err != nil {
+		var le *services.LockedError
+		if errors.As(err, &le) {
+			return locked(c, le)
+		}
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "file not found"})
+		}
+		if errors.Is(err, services.ErrNotPermitted) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"status": "unlocked"})
+}
+
+// GetMetadata returns the file's description and custom properties
+func (fc *FileController) GetMetadata(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+	ownerIDAny := c.Locals("user_id")
+	ownerID, _ := ownerIDAny.(uint)
+	meta, err := fc.Files.GetMetadata(ownerID, id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "file not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"id": meta.ID, "description": meta.Description, "properties": meta.Properties})
+}
+
+// SetMetadata replaces the file's description and custom properties
+func (fc *FileController) SetMetadata(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+	type req struct {
+		Description string            `json:"description"`
+		Properties  models.Properties `json:"properties"`
+	}
+	var body req
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
+	}
+	ownerIDAny := c.Locals("user_id")
+	ownerID, _ := ownerIDAny.(uint)
+	meta, err := fc.Files.SetMetadata(ownerID, id, body.Description, body.Properties)
+	if err != nil {
+		var le *services.LockedError
+		if errors.As(err, &le) {
+			return locked(c, le)
+		}
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "file not found"})
+		}
+		if errors.Is(err, services.ErrNotPermitted) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+		}
+		if errors.Is(err, services.ErrInvalidMetadata) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"id": meta.ID, "description": meta.Description, "properties": meta.Properties})
+}
+
+// Rename changes the file's display name
+func (fc *FileController) Rename(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+	type req struct {
+		Filename string `json:"filename"`
+	}
+	var body req
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
+	}
+	ownerIDAny := c.Locals("user_id")
+	ownerID, _ := ownerIDAny.(uint)
+	meta, err := fc.Files.Rename(ownerID, id, body.Filename)
+	if err != nil {
+		var le *services.LockedError
+		if errors.As(err, &le) {
+			return locked(c, le)
+		}
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "file not found"})
+		}
+		if errors.Is(err, services.ErrNotPermitted) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"id": meta.ID, "filename": meta.Filename})
+}
+
+type BatchRequest struct {
+	Mode       string                    `json:"mode"` // "atomic" (all-or-nothing) or "best_effort"
+	Operations []services.BatchOperation `json:"operations"`
+}
+
+// Batch applies several delete/move/tag/untag/share operations in one request
+func (fc *FileController) Batch(c *fiber.Ctx) error {
+	var body BatchRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
+	}
+	if body.Mode == "" {
+		body.Mode = "best_effort"
+	}
+	if body.Mode != "atomic" && body.Mode != "best_effort" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "mode must be atomic or best_effort"})
+	}
+	if len(body.Operations) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "operations required"})
+	}
+	if len(body.Operations) > config.C.BatchMaxOperations {
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{"error": fmt.Sprintf("at most %d operations per batch", config.C.BatchMaxOperations)})
+	}
+	ownerIDAny := c.Locals("user_id")
+	ownerID, _ := ownerIDAny.(uint)
+	results, committed := fc.Batches.Run(ownerID, body.Operations, body.Mode == "atomic")
+	status := fiber.StatusOK
+	if !committed {
+		status = fiber.StatusUnprocessableEntity
+	}
+	return c.Status(status).JSON(fiber.Map{"mode": body.Mode, "committed": committed, "results": results})
+}
+
+type ArchiveRequest struct {
+	FileIDs   []string          `json:"file_ids"`
+	FolderIDs []string          `json:"folder_ids"`
+	Password  string            `json:"password"`  // used for every file without an entry in Passwords
+	Passwords map[string]string `json:"passwords"` // file id -> password
+	Format    string            `json:"format"`    // "zip" (default) or "tar.gz"
+
+	IncludeMetadata bool `json:"include_metadata"` // add a metadata.json manifest with descriptions and properties
+}
+
+// Archive streams the selected files and folders back as a single zip or tar.gz archive
+func (fc *FileController) Archive(c *fiber.Ctx) error {
+	var body ArchiveRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
+	}
+	if body.Format == "" {
+		body.Format = services.ArchiveZip
+	}
+	if body.Format != services.ArchiveZip && body.Format != services.ArchiveTarGz {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "format must be zip or tar.gz"})
+	}
+	fileIDs, err := parseUUIDs(body.FileIDs)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid file_ids"})
+	}
+	folderIDs, err := parseUUIDs(body.FolderIDs)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid folder_ids"})
+	}
+	if len(fileIDs)+len(folderIDs) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "file_ids or folder_ids required"})
+	}
+	ownerIDAny := c.Locals("user_id")
+	ownerID, _ := ownerIDAny.(uint)
+	entries, err := fc.Files.ResolveArchive(ownerID, fileIDs, folderIDs)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "file or folder not found"})
+	}
+	if len(entries) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "nothing to archive"})
+	}
+	if body.IncludeMetadata {
+		manifest, err := fc.Files.MetadataManifest(entries)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		entries = append(entries, manifest)
+	}
+	passwordFor := func(f *models.EncryptedFile) string {
+		if p, ok := body.Passwords[f.ID.String()]; ok {
+			return p
+		}
+		return body.Password
+	}
+	return sendArchive(c, fc.Files, "archive", body.Format, entries, passwordFor, nil)
+}
+
+// sendArchive verifies all passwords and then streams the archive as the response body.
+// done, when set, is told how the archive ended.
+func sendArchive(c *fiber.Ctx, files *services.FileService, name, format string, entries []services.ArchiveEntry, passwordFor func(*models.EncryptedFile) string, done downloadDone) error {
+	if done == nil {
+		done = func(error, int64) {}
+	}
+	if err := files.VerifyArchivePasswords(entries, passwordFor); err != nil {
+		done(err, 0)
+		var pe *services.ArchivePasswordError
+		if errors.As(err, &pe) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid password", "file_ids": pe.FileIDs})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	contentType := "application/zip"
+	if format == services.ArchiveTarGz {
+		contentType = "application/gzip"
+	}
+	c.Set("Content-Type", contentType)
+	c.Set("Content-Disposition", "attachment; filename=\""+url.QueryEscape(name+"."+format)+"\"")
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		cw := &countingWriter{w: w}
+		err := files.WriteArchive(cw, format, entries, passwordFor)
+		if err != nil {
+			log.Printf("archive stream aborted: %v", err)
+		}
+		if ferr := w.Flush(); err == nil {
+			err = ferr
+		}
+		done(err, cw.n)
+	})
+	return nil
+}
+
+func parseUUIDs(in []string) ([]uuid.UUID, error) {
+	out := make([]uuid.UUID, 0, len(in))
+	for _, s := range in {
+		id, err := uuid.Parse(s)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, id)
+	}
+	return out, nil
+}
+
+// Preview returns a decrypted preview of the current version (?kind=thumb_64|thumb_256|thumb_512|text)
+func (fc *FileController) Preview(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+	pwd := c.Query("password")
+	if pwd == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "password required"})
+	}
+	ownerIDAny := c.Locals("user_id")
+	ownerID, _ := ownerIDAny.(uint)
+	kind := c.Query("kind")
+	if kind == "" {
+		// pick the medium thumbnail if there is one, otherwise whatever exists
+		list, err := fc.Files.ListPreviews(ownerID, id)
+		if err != nil || len(list) == 0 {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "no preview available"})
+		}
+		kind = list[0].Kind
+		for _, p := range list {
+			if p.Kind == services.PreviewThumb256 {
+				kind = p.Kind
+			}
+		}
+	}
+	r, p, err := fc.Files.OpenPreview(ownerID, id, kind, pwd)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "no preview available"})
+		}
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid password"})
+	}
+	c.Set("Content-Type", p.MimeType)
+	c.Set("X-Content-Type-Options", "nosniff")
+	c.Set("Cache-Control", "private, no-store")
+	return c.SendStream(r)
+}
+
+// Policy describes the active content policy so clients can validate files before uploading
+func (fc *FileController) Policy(c *fiber.Ctx) error {
+	if fc.Files.Policy == nil {
+		return c.JSON(fiber.Map{"enabled": false})
+	}
+	summary := fc.Files.Policy.Summary()
+	summary["enabled"] = true
+	return c.JSON(summary)
+}
@@ -0,0 +1,178 @@
+package controllers
+
+import (
+	"errors"
+	"time"
+
+	"file_project/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// FileRequestController manages upload-only links into a folder
+type FileRequestController struct {
+	Requests *services.FileRequestService
+}
+
+type CreateFileRequestRequest struct {
+	FolderID         string   `json:"folder_id"`
+	Title            string   `json:"title"`
+	ExpiresInMinutes *int     `json:"expires_in_minutes"`
+	MaxFiles         *int     `json:"max_files"`
+	MaxFileSize      int64    `json:"max_file_size"` // bytes, 0 = no limit
+	AllowedTypes     []string `json:"allowed_types"`
+	RequireUploader  bool     `json:"require_uploader"`
+	Password         string   `json:"password"` // uploaded files are encrypted under it
+}
+
+// fileRequestRefused answers an upload the request does not accept, with the reason
+func fileRequestRefused(c *fiber.Ctx, err error) error {
+	var r *services.UploadRefused
+	if !errors.As(err, &r) {
+		return uploadError(c, err)
+	}
+	status := fiber.StatusForbidden
+	switch r.Reason {
+	case services.RequestNotFound:
+		status = fiber.StatusNotFound
+	case services.RequestClosed, services.RequestExpired:
+		status = fiber.StatusGone
+	case services.RequestTooLarge:
+		status = fiber.StatusRequestEntityTooLarge
+	case services.RequestTypeNotAllowed:
+		status = fiber.StatusUnsupportedMediaType
+	case services.RequestUploaderRequired:
+		status = fiber.StatusBadRequest
+	}
+	return c.Status(status).JSON(fiber.Map{"error": r.Message, "reason": r.Reason})
+}
+
+// Create opens a file request into a folder owned by the requester
+func (fc *FileRequestController) Create(c *fiber.Ctx) error {
+	var body CreateFileRequestRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
+	}
+	folderID, err := uuid.Parse(body.FolderID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid folder_id"})
+	}
+	opts := services.FileRequestOptions{
+		FolderID:        folderID,
+		Title:           body.Title,
+		MaxFiles:        body.MaxFiles,
+		MaxFileSize:     body.MaxFileSize,
+		AllowedTypes:    body.AllowedTypes,
+		RequireUploader: body.RequireUploader,
+		Password:        body.Password,
+	}
+	if body.ExpiresInMinutes != nil && *body.ExpiresInMinutes > 0 {
+		t := time.Now().Add(time.Duration(*body.ExpiresInMinutes) * time.Minute)
+		opts.ExpiresAt = &t
+	}
+	ownerIDAny := c.Locals("user_id")
+	ownerID, _ := ownerIDAny.(uint)
+	req, err := fc.Requests.Create(ownerID, opts)
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "folder not found"})
+		case errors.Is(err, services.ErrInvalidFileRequest):
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		default:
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"id":               req.ID,
+		"token":            req.Token,
+		"url":              "/request/" + req.Token,
+		"folder_id":        req.FolderID,
+		"title":            req.Title,
+		"expires_at":       req.ExpiresAt,
+		"max_files":        req.MaxFiles,
+		"max_file_size":    req.MaxFileSize,
+		"allowed_types":    req.AllowedTypes,
+		"require_uploader": req.RequireUploader,
+	})
+}
+
+// List returns the requester's file requests with their usage
+func (fc *FileRequestController) List(c *fiber.Ctx) error {
+	ownerIDAny := c.Locals("user_id")
+	ownerID, _ := ownerIDAny.(uint)
+	list, err := fc.Requests.List(ownerID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(list)
+}
+
+// Update closes or reopens a file request (body: {"disabled": true|false})
+func (fc *FileRequestController) Update(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+	var body struct {
+		Disabled *bool `json:"disabled"`
+	}
+	if err := c.BodyParser(&body); err != nil || body.Disabled == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "disabled must be a boolean"})
+	}
+	ownerIDAny := c.Locals("user_id")
+	ownerID, _ := ownerIDAny.(uint)
+	req, err := fc.Requests.SetDisabled(id, ownerID, *body.Disabled)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(req)
+}
+
+// Delete removes a file request; files already uploaded stay in the folder
+func (fc *FileRequestController) Delete(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+	ownerIDAny := c.Locals("user_id")
+	ownerID, _ := ownerIDAny.(uint)
+	if err := fc.Requests.Delete(id, ownerID); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not found"})
+	}
+	return c.JSON(fiber.Map{"status": "deleted"})
+}
+
+// PublicInfo tells an uploader what a request accepts. No authentication required.
+func (fc *FileRequestController) PublicInfo(c *fiber.Ctx) error {
+	info, err := fc.Requests.Info(c.Params("token"), time.Now())
+	if err != nil {
+		return fileRequestRefused(c, err)
+	}
+	return c.JSON(info)
+}
+
+// PublicUpload adds one file through a request. Form fields: file, and optional name, email and message.
+// The uploader learns nothing about the folder beyond the new file's ID.
+func (fc *FileRequestController) PublicUpload(c *fiber.Ctx) error {
+	file, err := c.FormFile("file")
+	if err != nil || file == nil || file.Size == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "file is required"})
+	}
+	up := services.Uploader{Name: c.FormValue("name"), Email: c.FormValue("email"), Message: c.FormValue("message")}
+	meta, err := fc.Requests.Upload(c.Params("token"), file, up, time.Now())
+	if err != nil {
+		return fileRequestRefused(c, err)
+	}
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"id":            meta.ID,
+		"filename":      meta.Filename,
+		"original_size": meta.OriginalSize,
+		"sha256":        meta.SHA256,
+	})
+}
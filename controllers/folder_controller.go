@@ -0,0 +1,93 @@
+package controllers
+
+import (
+	"errors"
+
+	"file_project/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type FolderController struct {
+	Files *services.FileService
+}
+
+type CreateFolderRequest struct {
+	Name     string  `json:"name"`
+	ParentID *string `json:"parent_id"`
+}
+
+func (fc *FolderController) Create(c *fiber.Ctx) error {
+	var body CreateFolderRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
+	}
+	var parentID *uuid.UUID
+	if body.ParentID != nil {
+		id, err := uuid.Parse(*body.ParentID)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid parent_id"})
+		}
+		parentID = &id
+	}
+	ownerIDAny := c.Locals("user_id")
+	ownerID, _ := ownerIDAny.(uint)
+	folder, err := fc.Files.CreateFolder(ownerID, body.Name, parentID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(fiber.StatusCreated).JSON(folder)
+}
+
+func (fc *FolderController) List(c *fiber.Ctx) error {
+	ownerIDAny := c.Locals("user_id")
+	ownerID, _ := ownerIDAny.(uint)
+	list, err := fc.Files.ListFolders(ownerID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(list)
+}
+
+func (fc *FolderController) Delete(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+	ownerIDAny := c.Locals("user_id")
+	ownerID, _ := ownerIDAny.(uint)
+	if err := fc.Files.DeleteFolder(ownerID, id); err != nil {
+		if errors.Is(err, services.ErrLegalHold) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "folder is under legal hold or retention lock", "code": "legal_hold"})
+		}
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"status": "deleted"})
+}
+
+// SetRetention sets how many days after upload files directly in the folder expire (0 = never)
+func (fc *FolderController) SetRetention(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+	type req struct {
+		RetentionDays int `json:"retention_days"`
+	}
+	var body req
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
+	}
+	ownerIDAny := c.Locals("user_id")
+	ownerID, _ := ownerIDAny.(uint)
+	folder, err := fc.Files.SetFolderRetention(ownerID, id, body.RetentionDays)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "folder not found"})
+		}
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(folder)
+}
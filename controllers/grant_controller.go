@@ -0,0 +1,176 @@
+package controllers
+
+import (
+	"errors"
+	"time"
+
+	"file_project/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// GrantController manages shares of files with named users (no bearer tokens)
+type GrantController struct {
+	Grants *services.FileShareService
+}
+
+type GrantRequest struct {
+	Email      string     `json:"email"`
+	Permission string     `json:"permission"` // view, download, edit or manage
+	ExpiresAt  *time.Time `json:"expires_at"`
+
+	// Optional own password for the share; Password (the file password) is then needed to copy the key
+	Password      string `json:"password"`
+	SharePassword string `json:"share_password"`
+	Version       *int   `json:"version"`
+}
+
+// grantError maps share failures to HTTP responses
+func grantError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "file not found"})
+	case errors.Is(err, services.ErrNotPermitted), errors.Is(err, services.ErrQuarantined):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidGrant):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, services.ErrNoDataKey):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, services.ErrWrongPassword):
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid password"})
+	default:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+}
+
+// Grant shares a file with a registered user or invites an email address
+func (gc *GrantController) Grant(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+	var body GrantRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
+	}
+	if body.SharePassword != "" && body.Password == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "password (the file password) required to give the share its own password"})
+	}
+	userIDAny := c.Locals("user_id")
+	userID, _ := userIDAny.(uint)
+	share, err := gc.Grants.Grant(userID, id, services.GrantRequest{
+		Email:         body.Email,
+		Permission:    body.Permission,
+		ExpiresAt:     body.ExpiresAt,
+		Password:      body.Password,
+		SharePassword: body.SharePassword,
+		Version:       body.Version,
+	})
+	if err != nil {
+		return grantError(c, err)
+	}
+	status := "granted"
+	if share.GranteeID == nil {
+		status = "invited"
+	}
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"status": status, "share": share})
+}
+
+// List returns everyone the file is shared with, including pending invitations
+func (gc *GrantController) List(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+	userIDAny := c.Locals("user_id")
+	userID, _ := userIDAny.(uint)
+	list, err := gc.Grants.List(userID, id)
+	if err != nil {
+		return grantError(c, err)
+	}
+	return c.JSON(list)
+}
+
+// Revoke removes one person's access to the file
+func (gc *GrantController) Revoke(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+	shareID, err := uuid.Parse(c.Params("shareId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid share id"})
+	}
+	userIDAny := c.Locals("user_id")
+	userID, _ := userIDAny.(uint)
+	if err := gc.Grants.Revoke(userID, id, shareID); err != nil {
+		return grantError(c, err)
+	}
+	return c.JSON(fiber.Map{"status": "revoked"})
+}
+
+// SharedWithMe lists the files other users shared with the caller
+func (gc *GrantController) SharedWithMe(c *fiber.Ctx) error {
+	userIDAny := c.Locals("user_id")
+	userID, _ := userIDAny.(uint)
+	list, err := gc.Grants.SharedWithMe(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(list)
+}
+
+// Claim takes over a pending invitation with the token the person sharing passed on
+func (gc *GrantController) Claim(c *fiber.Ctx) error {
+	type req struct {
+		Token string `json:"token"`
+	}
+	var body req
+	if err := c.BodyParser(&body); err != nil || body.Token == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "token is required"})
+	}
+	userIDAny := c.Locals("user_id")
+	userID, _ := userIDAny.(uint)
+	share, err := gc.Grants.ClaimInvite(userID, body.Token)
+	if err != nil {
+		if errors.Is(err, services.ErrNoInvite) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"status": "claimed", "share": share})
+}
+
+// Download streams a file shared with the caller, opened with the password from shareSecret: the body
+// of a POST, or ?password= on a GET (the share's own password when it has one, otherwise the file password)
+func (gc *GrantController) Download(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+	pwd := shareSecret(c)
+	if pwd == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "password required"})
+	}
+	userIDAny := c.Locals("user_id")
+	userID, _ := userIDAny.(uint)
+	r, meta, v, err := gc.Grants.Open(userID, id, pwd)
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "file not found"})
+		case errors.Is(err, services.ErrNotPermitted), errors.Is(err, services.ErrQuarantined):
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, services.ErrShareKeyStale), errors.Is(err, services.ErrShredded):
+			return c.Status(fiber.StatusGone).JSON(fiber.Map{"error": err.Error()})
+		default:
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid password or file not found"})
+		}
+	}
+	if v != nil {
+		return sendPlaintext(c, r, meta.Filename, v.MimeType, v.OriginalSize)
+	}
+	return sendPlaintext(c, r, meta.Filename, meta.MimeType, meta.OriginalSize)
+}
@@ -0,0 +1,76 @@
+package controllers
+
+import (
+	"errors"
+
+	"file_project/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// HoldController manages legal holds and retention locks. Routes are admin only; the service
+// additionally requires the separate hold privilege.
+type HoldController struct {
+	Holds *services.HoldService
+}
+
+func (hc *HoldController) List(c *fiber.Ctx) error {
+	actorIDAny := c.Locals("user_id")
+	actorID, _ := actorIDAny.(uint)
+	files, folders, err := hc.Holds.List(actorID)
+	if err != nil {
+		return holdError(c, err)
+	}
+	return c.JSON(fiber.Map{"files": files, "folders": folders})
+}
+
+func (hc *HoldController) SetFileHold(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+	var body services.HoldUpdate
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
+	}
+	actorIDAny := c.Locals("user_id")
+	actorID, _ := actorIDAny.(uint)
+	f, err := hc.Holds.SetFileHold(actorID, id, body)
+	if err != nil {
+		return holdError(c, err)
+	}
+	return c.JSON(f)
+}
+
+func (hc *HoldController) SetFolderHold(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+	var body services.HoldUpdate
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
+	}
+	actorIDAny := c.Locals("user_id")
+	actorID, _ := actorIDAny.(uint)
+	f, err := hc.Holds.SetFolderHold(actorID, id, body)
+	if err != nil {
+		return holdError(c, err)
+	}
+	return c.JSON(f)
+}
+
+func holdError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, services.ErrNotHoldManager):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, services.ErrRetentionLocked):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not found"})
+	default:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+}
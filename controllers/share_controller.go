@@ -1,12 +1,17 @@
 package controllers
 
 import (
+	"encoding/json"
+	"errors"
 	"net/url"
+	"time"
 
+	"file_project/models"
 	"file_project/services"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 type ShareController struct {
@@ -16,70 +21,577 @@ type ShareController struct {
 
 type CreateShareRequest struct {
 	FileID           string `json:"file_id"`
+	FolderID         string `json:"folder_id"` // share a folder instead of a file
 	ExpiresInMinutes *int   `json:"expires_in_minutes"`
 	MaxDownloads     *int   `json:"max_downloads"`
+	Version          *int   `json:"version"` // pin a file version; omit to follow the latest
+
+	// Password is the file password. It is only needed here to copy the data key for a link with its own
+	// secret: SharePassword, or a random key returned in the URL fragment when KeyInURL is set.
+	Password      string `json:"password"`
+	SharePassword string `json:"share_password"`
+	KeyInURL      bool   `json:"key_in_url"`
+
+	HideFilename bool                     `json:"hide_filename"` // keep the name out of the public metadata
+	Restrictions models.ShareRestrictions `json:"restrictions"`
 }
 
-// Create a share link for a file owned by the requester
+// Create a share link for a file or folder owned by the requester
 func (sc *ShareController) Create(c *fiber.Ctx) error {
 	var body CreateShareRequest
-	if err := c.BodyParser(&body); err != nil || body.FileID == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
+	if err := c.BodyParser(&body); err != nil || (body.FileID == "") == (body.FolderID == "") {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload: give exactly one of file_id and folder_id"})
+	}
+	if body.FolderID != "" {
+		return sc.createFolderLink(c, body)
 	}
 	fileID, err := uuid.Parse(body.FileID)
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid file_id"})
 	}
+	if body.Version != nil && *body.Version < 1 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid version"})
+	}
+	if body.MaxDownloads != nil && *body.MaxDownloads < 1 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "max_downloads must be >= 1"})
+	}
 	ownerIDAny := c.Locals("user_id")
 	ownerID, _ := ownerIDAny.(uint)
-	// We rely on FileService to validate ownership when downloading via private endpoint; here we trust file id exists. Optionally could check.
-	link, err := sc.Shares.CreateShareLink(fileID, ownerID, body.ExpiresInMinutes, body.MaxDownloads)
+	// Only the owner can share a file, and quarantined files can never be shared
+	if _, err := sc.Files.Shareable(ownerID, fileID); err != nil {
+		if errors.Is(err, services.ErrQuarantined) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "file not found"})
+	}
+	var key *services.ShareKey
+	secret := body.SharePassword
+	if body.KeyInURL || secret != "" {
+		if body.KeyInURL && secret != "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "use either share_password or key_in_url"})
+		}
+		if !body.KeyInURL && len(secret) < 6 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "share_password must be >= 6 chars"})
+		}
+		if body.Password == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "password (the file password) required to protect the link with its own secret"})
+		}
+		if body.KeyInURL {
+			if secret, err = services.NewLinkSecret(); err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+			}
+		}
+		key, err = sc.Files.ShareKey(ownerID, fileID, body.Version, body.Password, secret)
+		if err != nil {
+			switch {
+			case errors.Is(err, services.ErrNoDataKey):
+				return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+			case errors.Is(err, gorm.ErrRecordNotFound):
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "file or version not found"})
+			default:
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid password or file not found"})
+			}
+		}
+		key.InURL = body.KeyInURL
+	}
+	link, err := sc.Shares.CreateShareLink(fileID, ownerID, body.ExpiresInMinutes, body.MaxDownloads, body.Version, key, body.Restrictions, body.HideFilename)
 	if err != nil {
+		if errors.Is(err, services.ErrInvalidRestriction) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
-	// return public URL path
+	// return public URL path of the landing metadata; a URL key goes in the fragment, which browsers
+	// never send to the server
+	linkURL := "/share/" + url.PathEscape(link.Token)
+	if body.KeyInURL {
+		linkURL += "#key=" + secret
+	}
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"id":            link.ID,
 		"token":         link.Token,
-		"url":           "/share/" + url.PathEscape(link.Token) + "/download",
+		"url":           linkURL,
+		"download_url":  "/share/" + url.PathEscape(link.Token) + "/download",
+		"hide_filename": link.HideFilename,
 		"expires_at":    link.ExpiresAt,
 		"max_downloads": link.MaxDownloads,
+		"version":       link.Version,
+		"protection":    link.Protection,
+		"restrictions":  link.Restrictions,
 	})
 }
 
-// Public download using share token; still requires password query param
+// createFolderLink shares a folder; its files are opened with their own password, so a folder link
+// cannot carry its own secret or pin a version.
+func (sc *ShareController) createFolderLink(c *fiber.Ctx, body CreateShareRequest) error {
+	folderID, err := uuid.Parse(body.FolderID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid folder_id"})
+	}
+	if body.Version != nil || body.SharePassword != "" || body.KeyInURL {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "version, share_password and key_in_url are only supported for file links"})
+	}
+	if body.MaxDownloads != nil && *body.MaxDownloads < 1 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "max_downloads must be >= 1"})
+	}
+	ownerIDAny := c.Locals("user_id")
+	ownerID, _ := ownerIDAny.(uint)
+	if _, err := sc.Files.Folders.FindByID(folderID, ownerID); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "folder not found"})
+	}
+	link, err := sc.Shares.CreateFolderLink(folderID, ownerID, body.ExpiresInMinutes, body.MaxDownloads, body.Restrictions, body.HideFilename)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidRestriction) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"id":            link.ID,
+		"token":         link.Token,
+		"url":           "/share/" + url.PathEscape(link.Token),
+		"list_url":      "/share/" + url.PathEscape(link.Token) + "/list",
+		"folder_id":     link.FolderID,
+		"hide_filename": link.HideFilename,
+		"expires_at":    link.ExpiresAt,
+		"max_downloads": link.MaxDownloads,
+		"protection":    link.Protection,
+		"restrictions":  link.Restrictions,
+	})
+}
+
+// PublicInfo describes a link to its recipient before any download: what it shares (the name unless
+// hidden), the size, expiry, downloads left and which secret opens it. It needs no password and does
+// not count as a download.
+func (sc *ShareController) PublicInfo(c *fiber.Ctx) error {
+	req := accessRequest(c, models.ShareActionInfo)
+	l, err := sc.Shares.Check(c.Params("token"), req)
+	if err != nil {
+		return shareDenied(c, err)
+	}
+	info := fiber.Map{
+		"expires_at":          l.ExpiresAt,
+		"remaining_downloads": services.RemainingDownloads(l),
+		"password_required":   l.Protection != models.ProtectURLKey, // url_key links open with the key in the URL
+		"protection":          l.Protection,
+	}
+	if l.FolderID != nil {
+		info["kind"] = "folder"
+		if !l.HideFilename {
+			info["name"] = l.Folder.Name
+		}
+	} else {
+		info["kind"] = "file"
+		if !l.HideFilename {
+			info["filename"] = l.File.Filename
+		}
+		info["size"] = l.File.OriginalSize
+		if l.Version != nil {
+			info["version"] = *l.Version
+			if v, err := sc.Files.Versions.FindByVersion(*l.FileID, *l.Version); err == nil {
+				info["size"] = v.OriginalSize
+			}
+		}
+	}
+	sc.Shares.Record(l, req, l.FileID, models.AccessCompleted, "", 0)
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.JSON(info)
+}
+
+// shareSecret reads the secret that opens a shared file: password (the link's own password, or the
+// file password) or key (from the link's URL fragment). POST requests carry it in a JSON or form body,
+// which keeps it out of URLs and request logs; GET requests still accept it in the query string.
+func shareSecret(c *fiber.Ctx) string {
+	var body struct {
+		Password string `json:"password" form:"password"`
+		Key      string `json:"key" form:"key"`
+	}
+	if c.Method() == fiber.MethodPost {
+		_ = c.BodyParser(&body)
+	} else {
+		body.Password, body.Key = c.Query("password"), c.Query("key")
+	}
+	if body.Key != "" {
+		return body.Key
+	}
+	return body.Password
+}
+
+// Public download using share token, opened with the secret from shareSecret
 func (sc *ShareController) PublicDownload(c *fiber.Ctx) error {
 	token := c.Params("token")
-	pwd := c.Query("password")
+	pwd := shareSecret(c)
 	if token == "" || pwd == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "token and password required"})
 	}
 
-	l, err := sc.Shares.ValidateAndRecord(token)
+	req := accessRequest(c, models.ShareActionDownload)
+	l, err := sc.Shares.Check(token, req)
+	if err != nil {
+		return shareDenied(c, err)
+	}
+	if l.FolderID != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "this link shares a folder: use /list, /files/:fileId/download or /archive"})
+	}
+	if l, err = sc.Shares.Claim(token, req); err != nil {
+		return shareDenied(c, err)
+	}
+	// the download only counts once the whole body was sent
+	done := sc.finish(l, req, l.FileID)
+
+	// a link with its own secret opens the file with its copy of the data key
+	if l.KeyID != nil {
+		r, meta, v, err := sc.Files.OpenShared(l, pwd)
+		if err != nil {
+			done(err, 0)
+			if errors.Is(err, services.ErrShareKeyStale) || errors.Is(err, services.ErrShredded) {
+				return c.Status(fiber.StatusGone).JSON(fiber.Map{"error": err.Error()})
+			}
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid password or file not found"})
+		}
+		return sendPlaintext(c, trackCompletion(r, v.OriginalSize, done), meta.Filename, v.MimeType, v.OriginalSize)
+	}
+	// open as the link's creator, so the file must (still) belong to whoever shared it
+	if l.Version != nil {
+		r, meta, v, err := sc.Files.OpenVersion(l.CreatedByUser, *l.FileID, *l.Version, pwd)
+		if err != nil {
+			done(err, 0)
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid password or file not found"})
+		}
+		return sendPlaintext(c, trackCompletion(r, v.OriginalSize, done), meta.Filename, v.MimeType, v.OriginalSize)
+	}
+	r, meta, err := sc.Files.Open(l.CreatedByUser, *l.FileID, pwd)
+	if err != nil {
+		done(err, 0)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid password or file not found"})
+	}
+	return sendPlaintext(c, trackCompletion(r, meta.OriginalSize, done), meta.Filename, meta.MimeType, meta.OriginalSize)
+}
+
+// finish returns the completion callback of a claimed download: it records the access and gives the
+// claim back unless everything was sent
+func (sc *ShareController) finish(l *models.ShareLink, req services.AccessRequest, fileID *uuid.UUID) downloadDone {
+	return func(err error, sent int64) {
+		if err == nil {
+			sc.Shares.Record(l, req, fileID, models.AccessCompleted, "", sent)
+			return
+		}
+		sc.Shares.Release(l.ID)
+		var pe *services.ArchivePasswordError
+		switch {
+		case errors.Is(err, errIncomplete):
+			sc.Shares.Record(l, req, fileID, models.AccessIncomplete, "", sent)
+		case errors.Is(err, services.ErrWrongPassword), errors.As(err, &pe):
+			sc.Shares.Record(l, req, fileID, models.AccessFailed, "wrong_password", sent)
+		case errors.Is(err, services.ErrShareKeyStale), errors.Is(err, services.ErrShredded):
+			sc.Shares.Record(l, req, fileID, models.AccessFailed, "key_unavailable", sent)
+		case errors.Is(err, gorm.ErrRecordNotFound), errors.Is(err, services.ErrOutsideSharedFolder):
+			sc.Shares.Record(l, req, fileID, models.AccessFailed, "file_not_found", sent)
+		case sent > 0:
+			sc.Shares.Record(l, req, fileID, models.AccessIncomplete, "", sent)
+		default:
+			sc.Shares.Record(l, req, fileID, models.AccessFailed, "error", sent)
+		}
+	}
+}
+
+// folderLink checks a token for a folder link; a file link is reported as not found
+func (sc *ShareController) folderLink(c *fiber.Ctx, req services.AccessRequest, claim bool) (*models.ShareLink, error) {
+	token := c.Params("token")
+	l, err := sc.Shares.Check(token, req)
 	if err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": err.Error()})
+		return nil, shareDenied(c, err)
+	}
+	if l.FolderID == nil {
+		return nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not a folder link"})
 	}
+	if claim {
+		if l, err = sc.Shares.Claim(token, req); err != nil {
+			return nil, shareDenied(c, err)
+		}
+	}
+	return l, nil
+}
 
-	plain, filename, err := sc.Files.DecryptAndRead(l.File.OwnerID, l.FileID, pwd)
+// PublicList lists a shared folder (?folder= for a sub-folder) without counting a download.
+// Files added to the folder later show up automatically.
+func (sc *ShareController) PublicList(c *fiber.Ctx) error {
+	req := accessRequest(c, models.ShareActionList)
+	l, err := sc.folderLink(c, req, false)
+	if l == nil {
+		return err
+	}
+	var folderID *uuid.UUID
+	if q := c.Query("folder"); q != "" {
+		id, err := uuid.Parse(q)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid folder"})
+		}
+		folderID = &id
+	}
+	listing, err := sc.Files.ListSharedFolder(&l.Folder, folderID)
 	if err != nil {
+		if errors.Is(err, services.ErrOutsideSharedFolder) {
+			sc.Shares.Record(l, req, nil, models.AccessFailed, "folder_not_found", 0)
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "folder not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	sc.Shares.Record(l, req, nil, models.AccessCompleted, "", 0)
+	return c.JSON(listing)
+}
+
+// PublicFileDownload downloads one file of a shared folder with its password (see shareSecret).
+// It counts against the link's download limit.
+func (sc *ShareController) PublicFileDownload(c *fiber.Ctx) error {
+	fileID, err := uuid.Parse(c.Params("fileId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid file id"})
+	}
+	pwd := shareSecret(c)
+	if pwd == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "password required"})
+	}
+	req := accessRequest(c, models.ShareActionDownload)
+	l, err := sc.folderLink(c, req, true)
+	if l == nil {
+		return err
+	}
+	done := sc.finish(l, req, &fileID)
+	r, meta, err := sc.Files.OpenInSharedFolder(&l.Folder, fileID, pwd)
+	if err != nil {
+		done(err, 0)
+		if errors.Is(err, services.ErrOutsideSharedFolder) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "file not found"})
+		}
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid password or file not found"})
 	}
+	return sendPlaintext(c, trackCompletion(r, meta.OriginalSize, done), meta.Filename, meta.MimeType, meta.OriginalSize)
+}
 
-	c.Set("Content-Type", "application/octet-stream")
-	c.Set("Content-Disposition", "attachment; filename=\""+filename+"\"")
+// PublicArchive downloads a whole shared folder as one archive (?format=zip|tar.gz). Every file is
+// opened with the password (see shareSecret); the archive counts as one download against the link's limit.
+func (sc *ShareController) PublicArchive(c *fiber.Ctx) error {
+	pwd := shareSecret(c)
+	if pwd == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "password required"})
+	}
+	format := c.Query("format", services.ArchiveZip)
+	if format != services.ArchiveZip && format != services.ArchiveTarGz {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "format must be zip or tar.gz"})
+	}
+	req := accessRequest(c, models.ShareActionArchive)
+	l, err := sc.folderLink(c, req, true)
+	if l == nil {
+		return err
+	}
+	done := sc.finish(l, req, nil)
+	entries, err := sc.Files.ResolveArchive(l.CreatedByUser, nil, []uuid.UUID{*l.FolderID})
+	if err != nil {
+		done(err, 0)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	passwordFor := func(*models.EncryptedFile) string { return pwd }
+	return sendArchive(c, sc.Files, l.Folder.Name, format, entries, passwordFor, done)
+}
+
+// accessRequest collects what share link restrictions are checked against and the access log records
+func accessRequest(c *fiber.Ctx, action string) services.AccessRequest {
+	return services.AccessRequest{
+		IP:        c.IP(),
+		Origin:    c.Get(fiber.HeaderOrigin),
+		Referer:   c.Get(fiber.HeaderReferer),
+		UserAgent: c.Get(fiber.HeaderUserAgent),
+		Action:    action,
+		Now:       time.Now(),
+	}
+}
 
-	return c.Send(plain)
+// shareDenied answers a refused share download with the reason
+func shareDenied(c *fiber.Ctx, err error) error {
+	var d *services.ShareDenied
+	if !errors.As(err, &d) {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	status := fiber.StatusForbidden
+	if d.Reason == services.DenyNotFound {
+		status = fiber.StatusNotFound
+	}
+	return c.Status(status).JSON(fiber.Map{"error": d.Message, "reason": d.Reason})
 }
 
-// Delete a share link by token (owner only)
+// Delete a share link by its ID (owner only)
 func (sc *ShareController) Delete(c *fiber.Ctx) error {
-	token := c.Params("token")
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
 	ownerIDAny := c.Locals("user_id")
 	ownerID, _ := ownerIDAny.(uint)
-	if token == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "token required"})
-	}
-	if err := sc.Shares.Delete(token, ownerID); err != nil {
+	if err := sc.Shares.Delete(id, ownerID); err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not found"})
 	}
 	return c.JSON(fiber.Map{"status": "deleted"})
 }
+
+// List returns the requester's share links with their usage
+func (sc *ShareController) List(c *fiber.Ctx) error {
+	ownerIDAny := c.Locals("user_id")
+	ownerID, _ := ownerIDAny.(uint)
+	list, err := sc.Shares.List(ownerID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(list)
+}
+
+// ListForFile returns the requester's share links to one file with their usage
+func (sc *ShareController) ListForFile(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+	ownerIDAny := c.Locals("user_id")
+	ownerID, _ := ownerIDAny.(uint)
+	list, err := sc.Shares.ListForFile(id, ownerID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(list)
+}
+
+// Update changes a link's expiry or download limit, or disables/re-enables it.
+// Body fields: expires_at (RFC 3339 or null), expires_in_minutes, max_downloads (number or null), disabled,
+// hide_filename, restrictions (replaces all of them).
+func (sc *ShareController) Update(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(c.Body(), &body); err != nil || len(body) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid payload"})
+	}
+	var u services.ShareUpdate
+	if raw, ok := body["expires_at"]; ok {
+		if err := json.Unmarshal(raw, &u.ExpiresAt); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "expires_at must be an RFC 3339 time or null"})
+		}
+		u.SetExpiresAt = true
+	}
+	if raw, ok := body["expires_in_minutes"]; ok {
+		var minutes int
+		if err := json.Unmarshal(raw, &minutes); err != nil || minutes < 1 || u.SetExpiresAt {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "expires_in_minutes must be >= 1 and cannot be combined with expires_at"})
+		}
+		t := time.Now().Add(time.Duration(minutes) * time.Minute)
+		u.SetExpiresAt, u.ExpiresAt = true, &t
+	}
+	if raw, ok := body["max_downloads"]; ok {
+		if err := json.Unmarshal(raw, &u.MaxDownloads); err != nil || (u.MaxDownloads != nil && *u.MaxDownloads < 1) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "max_downloads must be >= 1 or null"})
+		}
+		u.SetMaxDownloads = true
+	}
+	if raw, ok := body["restrictions"]; ok {
+		u.Restrictions = &models.ShareRestrictions{}
+		if err := json.Unmarshal(raw, u.Restrictions); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid restrictions"})
+		}
+	}
+	if raw, ok := body["hide_filename"]; ok {
+		if err := json.Unmarshal(raw, &u.HideFilename); err != nil || u.HideFilename == nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "hide_filename must be a boolean"})
+		}
+	}
+	if raw, ok := body["disabled"]; ok {
+		if err := json.Unmarshal(raw, &u.Disabled); err != nil || u.Disabled == nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "disabled must be a boolean"})
+		}
+	}
+	ownerIDAny := c.Locals("user_id")
+	ownerID, _ := ownerIDAny.(uint)
+	link, err := sc.Shares.Update(id, ownerID, u)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not found"})
+		}
+		if errors.Is(err, services.ErrInvalidRestriction) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(link)
+}
+
+// RevokeAll deletes every share link the requester created for a file
+func (sc *ShareController) RevokeAll(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+	ownerIDAny := c.Locals("user_id")
+	ownerID, _ := ownerIDAny.(uint)
+	n, err := sc.Shares.RevokeAll(id, ownerID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"status": "revoked", "revoked": n})
+}
+
+// accessPageSize is how many accesses one request for a link's log returns
+const accessPageSize = 200
+
+// Accesses returns the latest recorded uses of one of the requester's links
+func (sc *ShareController) Accesses(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+	ownerIDAny := c.Locals("user_id")
+	ownerID, _ := ownerIDAny.(uint)
+	list, err := sc.Shares.ListAccesses(id, ownerID, accessPageSize)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(list)
+}
+
+// Stats summarizes the uses of one of the requester's links
+func (sc *ShareController) Stats(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+	ownerIDAny := c.Locals("user_id")
+	ownerID, _ := ownerIDAny.(uint)
+	stats, err := sc.Shares.Stats(id, ownerID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(stats)
+}
+
+// FileStats summarizes every use of the requester's links that served one of their files
+func (sc *ShareController) FileStats(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+	ownerIDAny := c.Locals("user_id")
+	ownerID, _ := ownerIDAny.(uint)
+	if _, err := sc.Files.Files.FindByID(id, ownerID); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "file not found"})
+	}
+	stats, err := sc.Shares.FileStats(id)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(stats)
+}
@@ -0,0 +1,68 @@
+package controllers
+
+import (
+	"errors"
+
+	"file_project/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+type TrashController struct {
+	Files *services.FileService
+}
+
+// List returns the requester's trashed files
+func (tc *TrashController) List(c *fiber.Ctx) error {
+	ownerIDAny := c.Locals("user_id")
+	ownerID, _ := ownerIDAny.(uint)
+	list, err := tc.Files.ListTrash(ownerID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(list)
+}
+
+// Restore moves a trashed file back into the vault
+func (tc *TrashController) Restore(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+	ownerIDAny := c.Locals("user_id")
+	ownerID, _ := ownerIDAny.(uint)
+	if err := tc.Files.Restore(ownerID, id); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "file not found in trash"})
+	}
+	return c.JSON(fiber.Map{"status": "restored"})
+}
+
+// Delete permanently removes a single trashed file
+func (tc *TrashController) Delete(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+	ownerIDAny := c.Locals("user_id")
+	ownerID, _ := ownerIDAny.(uint)
+	guarantee, err := tc.Files.DeletePermanently(ownerID, id)
+	if err != nil {
+		if errors.Is(err, services.ErrLegalHold) {
+			return legalHold(c)
+		}
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "file not found in trash"})
+	}
+	return c.JSON(fiber.Map{"status": "deleted", "guarantee": guarantee})
+}
+
+// Empty permanently removes everything in the requester's trash
+func (tc *TrashController) Empty(c *fiber.Ctx) error {
+	ownerIDAny := c.Locals("user_id")
+	ownerID, _ := ownerIDAny.(uint)
+	n, guarantee, err := tc.Files.EmptyTrash(ownerID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error(), "purged": n})
+	}
+	return c.JSON(fiber.Map{"status": "emptied", "purged": n, "guarantee": guarantee})
+}
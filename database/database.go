@@ -37,10 +37,51 @@ func Connect() error {
 	// Enable uuid extension (safe if exists)
 	DB.Exec("CREATE EXTENSION IF NOT EXISTS \"uuid-ossp\"")
 
+	if err := migrateShareTokens(DB); err != nil {
+		return err
+	}
+
 	// Auto-migrate models
-	if err := DB.AutoMigrate(&models.User{}, &models.EncryptedFile{}, &models.ShareLink{}); err != nil {
+	if err := DB.AutoMigrate(&models.User{}, &models.EncryptedFile{}, &models.ShareLink{}, &models.FileVersion{}, &models.VersionPolicy{}, &models.Folder{}, &models.FileTag{}, &models.FilePreview{}, &models.Blob{}, &models.DedupSetting{}, &models.RetentionPolicy{}, &models.AuditLog{}, &models.DataKey{}, &models.FileLock{}, &models.FileShare{}, &models.FileRequest{}, &models.ShareAccess{}); err != nil {
+		return err
+	}
+
+	// Share links may point at a folder instead of a file since folder links were introduced
+	if err := DB.Exec(`ALTER TABLE share_links ALTER COLUMN file_id DROP NOT NULL`).Error; err != nil {
+		return err
+	}
+
+	// Files uploaded before versioning existed have no version rows; record their blob as version 1
+	if err := DB.Exec(`INSERT INTO file_versions (file_id, version, path, size, created_at)
+		SELECT f.id, f.version, f.path, f.size, f.created_at FROM encrypted_files f
+		WHERE NOT EXISTS (SELECT 1 FROM file_versions v WHERE v.file_id = f.id)`).Error; err != nil {
 		return err
 	}
 
 	return nil
 }
+
+// migrateShareTokens converts share links from the time the raw token was the primary key: each row
+// gets a public ID, its token is replaced by the token's SHA-256 and the token column is dropped.
+// Existing links keep working because lookups hash the presented token.
+func migrateShareTokens(db *gorm.DB) error {
+	if !db.Migrator().HasTable("share_links") || !db.Migrator().HasColumn("share_links", "token") {
+		return nil
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, stmt := range []string{
+			`ALTER TABLE share_links ADD COLUMN IF NOT EXISTS id uuid NOT NULL DEFAULT uuid_generate_v4()`,
+			`ALTER TABLE share_links ADD COLUMN IF NOT EXISTS token_hash varchar(64)`,
+			`UPDATE share_links SET token_hash = encode(sha256(convert_to(token, 'UTF8')), 'hex')`,
+			`ALTER TABLE share_links DROP CONSTRAINT IF EXISTS share_links_pkey`,
+			`ALTER TABLE share_links ADD PRIMARY KEY (id)`,
+			`ALTER TABLE share_links DROP COLUMN token`,
+		} {
+			if err := tx.Exec(stmt).Error; err != nil {
+				return err
+			}
+		}
+		log.Printf("share links migrated to hashed tokens")
+		return nil
+	})
+}
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"errors"
 	"log"
+	"time"
 
 	"file_project/config"
 	"file_project/controllers"
@@ -32,7 +34,7 @@ func main() {
 	app.Use(cors.New(cors.Config{
 		AllowOrigins: "http://localhost:5173", // Replace with your frontend's URL
 		AllowHeaders: "Origin, Content-Type, Accept, Authorization",
-		AllowMethods: "GET, POST, PATCH, DELETE",
+		AllowMethods: "GET, POST, PUT, PATCH, DELETE",
 	}))
 	// Health
 	app.Get("/health", func(c *fiber.Ctx) error { return c.SendString("OK") })
@@ -42,17 +44,110 @@ func main() {
 	authCtrl := &controllers.AuthController{Users: userRepo}
 
 	fileRepo := repositories.NewFileRepository(database.DB)
-	fileSvc := services.NewFileService(fileRepo)
-	fileCtrl := &controllers.FileController{Files: fileSvc}
+	versionRepo := repositories.NewFileVersionRepository(database.DB)
+	folderRepo := repositories.NewFolderRepository(database.DB)
+	previewRepo := repositories.NewFilePreviewRepository(database.DB)
+	blobRepo := repositories.NewBlobRepository(database.DB)
+	keyRepo := repositories.NewDataKeyRepository(database.DB)
+	fileSvc := services.NewFileService(fileRepo, versionRepo, folderRepo, previewRepo, blobRepo, keyRepo)
+	if config.C.ClamdAddress != "" {
+		scanner, err := services.NewClamdScanner(config.C.ClamdAddress, time.Duration(config.C.ScanTimeoutSeconds)*time.Second)
+		if err != nil {
+			log.Fatalf("invalid scanner config: %v", err)
+		}
+		fileSvc.Scanner = scanner
+		fileSvc.ScanFailOpen = config.C.ScanFailOpen
+	}
+	if config.C.ContentPolicyFile != "" {
+		policy, err := services.LoadContentPolicy(config.C.ContentPolicyFile)
+		if err != nil {
+			log.Fatalf("failed to load content policy: %v", err)
+		}
+		fileSvc.Policy = policy
+	}
+	batchSvc := services.NewBatchService(database.DB)
+	auditRepo := repositories.NewAuditRepository(database.DB)
+	retentionSvc := services.NewRetentionService(fileSvc, repositories.NewRetentionRepository(database.DB), auditRepo)
+	fileCtrl := &controllers.FileController{Files: fileSvc, Batches: batchSvc, Retention: retentionSvc}
+	folderCtrl := &controllers.FolderController{Files: fileSvc}
+	trashCtrl := &controllers.TrashController{Files: fileSvc}
 
 	shareRepo := repositories.NewShareLinkRepository(database.DB)
-	shareSvc := services.NewShareLinkService(shareRepo)
+	shareSvc := services.NewShareLinkService(shareRepo, repositories.NewShareAccessRepository(database.DB))
 	shareCtrl := &controllers.ShareController{Shares: shareSvc, Files: fileSvc}
+	grantRepo := repositories.NewFileShareRepository(database.DB)
+	fileSvc.Grants = grantRepo
+	grantSvc := services.NewFileShareService(grantRepo, userRepo, fileSvc)
+	grantCtrl := &controllers.GrantController{Grants: grantSvc}
+	fileRequestSvc := services.NewFileRequestService(repositories.NewFileRequestRepository(database.DB), fileSvc)
+	fileRequestCtrl := &controllers.FileRequestController{Requests: fileRequestSvc}
+
+	scrubSvc := services.NewScrubService(versionRepo, previewRepo)
+	adminCtrl := &controllers.AdminController{Scrubber: scrubSvc}
+	auditCtrl := &controllers.AuditController{Audit: auditRepo}
+	holdCtrl := &controllers.HoldController{Holds: services.NewHoldService(fileSvc, userRepo, auditRepo)}
 
 	// Register routes
 	routes.AuthRoutes(app, authCtrl)
 	routes.FileRoutes(app, fileCtrl)
+	routes.TrashRoutes(app, trashCtrl)
+	routes.FolderRoutes(app, folderCtrl)
+	routes.AdminRoutes(app, adminCtrl, holdCtrl)
+	routes.AuditRoutes(app, auditCtrl)
 	routes.ShareRoutes(app, shareCtrl)
+	routes.GrantRoutes(app, grantCtrl)
+	routes.FileRequestRoutes(app, fileRequestCtrl)
+
+	// Background jobs
+	go func() {
+		if n, err := fileSvc.BackfillSizes(); err != nil {
+			log.Printf("size backfill failed: %v", err)
+		} else if n > 0 {
+			log.Printf("size backfill: updated %d files", n)
+		}
+	}()
+	go func() {
+		if n, err := fileSvc.ResealMetadata(); err != nil {
+			log.Printf("metadata reseal failed: %v", err)
+		} else if n > 0 {
+			log.Printf("metadata reseal: moved %d files to METADATA_SECRET", n)
+		}
+		if n, err := fileRequestSvc.ResealKeys(); err != nil {
+			log.Printf("file request key reseal failed: %v", err)
+		} else if n > 0 {
+			log.Printf("file request key reseal: moved %d requests to FILE_REQUEST_SECRET", n)
+		}
+	}()
+	services.RunEvery("trash purge", time.Duration(config.C.TrashPurgeMinutes)*time.Minute, func() error {
+		n, err := fileSvc.PurgeTrash(time.Duration(config.C.TrashRetentionDays) * 24 * time.Hour)
+		if n > 0 {
+			log.Printf("trash purge: removed %d files", n)
+		}
+		return err
+	})
+	services.RunEvery("retention", time.Duration(config.C.RetentionMinutes)*time.Minute, func() error {
+		n, err := retentionSvc.Run()
+		if n > 0 {
+			log.Printf("retention: expired %d files", n)
+		}
+		return err
+	})
+	if config.C.ShareAccessDays > 0 {
+		services.RunEvery("share access log", time.Duration(config.C.AccessPruneMinutes)*time.Minute, func() error {
+			n, err := shareSvc.PruneAccesses(time.Duration(config.C.ShareAccessDays) * 24 * time.Hour)
+			if n > 0 {
+				log.Printf("share access log: removed %d records", n)
+			}
+			return err
+		})
+	}
+	services.RunEvery("integrity scrub", time.Duration(config.C.ScrubIntervalMins)*time.Minute, func() error {
+		_, err := scrubSvc.Run()
+		if errors.Is(err, services.ErrScrubRunning) {
+			return nil
+		}
+		return err
+	})
 
 	log.Printf("server running on :%s", config.C.AppPort)
 	if err := app.Listen(":" + config.C.AppPort); err != nil {
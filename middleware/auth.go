@@ -3,6 +3,7 @@ package middleware
 import (
 	"strings"
 
+	"file_project/models"
 	"file_project/utils"
 
 	"github.com/gofiber/fiber/v2"
@@ -26,5 +27,14 @@ func JWTProtected(c *fiber.Ctx) error {
 	c.Locals("user_id", claims.UserID)
 	c.Locals("email", claims.Email)
 	c.Locals("name", claims.Name)
+	c.Locals("role", claims.Role)
+	return c.Next()
+}
+
+// AdminOnly must run after JWTProtected and rejects non-admin users
+func AdminOnly(c *fiber.Ctx) error {
+	if role, _ := c.Locals("role").(string); role != models.RoleAdmin {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "admin only"})
+	}
 	return c.Next()
 }
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Audit actions
+const (
+	AuditFileExpired = "file.expired"
+	AuditHoldChanged = "hold.changed"
+)
+
+// AuditLog records an action taken on a user's data. ActorID is nil for actions taken by the
+// system itself, such as retention jobs.
+type AuditLog struct {
+	ID        uuid.UUID  `gorm:"type:uuid;default:uuid_generate_v4();primaryKey" json:"id"`
+	UserID    uint       `gorm:"not null;index" json:"user_id"`
+	ActorID   *uint      `json:"actor_id,omitempty"`
+	Action    string     `gorm:"size:50;not null;index" json:"action"`
+	FileID    *uuid.UUID `gorm:"type:uuid;index" json:"file_id,omitempty"`
+	Detail    string     `gorm:"size:500" json:"detail,omitempty"`
+	CreatedAt time.Time  `gorm:"index" json:"created_at"`
+}
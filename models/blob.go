@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Blob is an encrypted blob shared by several file versions of one owner through deduplication.
+// DedupKey is a keyed hash of the plaintext and RefCount the number of versions whose Path points here.
+// Blobs written without deduplication have no row and belong to their single version.
+type Blob struct {
+	ID         uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey" json:"id"`
+	OwnerID    uint      `gorm:"not null;uniqueIndex:idx_blobs_owner_key" json:"owner_id"`
+	DedupKey   string    `gorm:"size:64;not null;uniqueIndex:idx_blobs_owner_key" json:"-"`
+	Path       string    `gorm:"size:500;not null;uniqueIndex" json:"-"`
+	Size       int64     `gorm:"not null" json:"size"`
+	BlobSHA256 string    `gorm:"size:64" json:"blob_sha256"`
+	RefCount   int64     `gorm:"not null;default:1" json:"ref_count"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// DedupSetting records whether a user opted in to deduplication (off by default)
+type DedupSetting struct {
+	UserID    uint      `gorm:"primaryKey" json:"user_id"`
+	Enabled   bool      `gorm:"not null;default:false" json:"enabled"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
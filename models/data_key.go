@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DataKey is the random key a blob's chunks are encrypted with, stored wrapped (AES-GCM) under a key
+// derived from the file password and Salt. The blob header names its key by ID, so deleting the row
+// makes the blob unreadable even to someone who knows the password (crypto-shredding).
+// RefCount counts blobs that are byte-for-byte copies of each other, e.g. restored versions.
+type DataKey struct {
+	ID        uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	Salt      []byte    `gorm:"not null" json:"-"`
+	Wrapped   []byte    `gorm:"not null" json:"-"`
+	RefCount  int64     `gorm:"not null;default:1" json:"ref_count"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
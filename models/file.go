@@ -4,17 +4,55 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Malware scan states
+const (
+	ScanPending  = "pending" // not scanned (no scanner configured)
+	ScanClean    = "clean"
+	ScanInfected = "infected"
+	ScanError    = "error" // scanner failed and the upload was accepted anyway (SCAN_FAIL_OPEN)
 )
 
 // EncryptedFile metadata stored in DB; content is stored on disk in storage/ directory
 // We DO NOT store the password or key; only salt/nonce are stored in the file content header.
 // Path points to the file location on disk.
+// Size is the stored (ciphertext) size; OriginalSize, MimeType and SHA256 describe the plaintext of the current version.
+// ScanStatus is the malware scan verdict of the current version; infected files are quarantined.
+// LegalHold and RetainUntil make the file immutable (WORM): while either is in force, or a folder above
+// the file is held, the file cannot be deleted, re-keyed, given new versions or purged from the trash.
+// Metadata holds the description and custom properties, sealed under the server's metadata key; the
+// service decrypts it into Description and Properties, which are not stored as columns.
+// ExpiresAt, when set, moves the file to the trash automatically once it has passed (see RetentionService).
+// RetentionFrom, when set, is where folder and account retention rules start counting instead of CreatedAt.
+// Restoring a file from the trash sets it, so the rule that trashed the file does not do so again right away.
+// DeletedAt is set while the file sits in the trash; the blob is kept until it is purged.
 type EncryptedFile struct {
-	ID        uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey" json:"id"`
-	OwnerID   uint      `gorm:"not null" json:"owner_id"`
-	Filename  string    `gorm:"size=255;not null" json:"filename"`
-	Path      string    `gorm:"size=500;not null" json:"-"`
-	Size      int64     `gorm:"not null" json:"size"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID            uuid.UUID      `gorm:"type:uuid;default:uuid_generate_v4();primaryKey" json:"id"`
+	OwnerID       uint           `gorm:"not null" json:"owner_id"`
+	FolderID      *uuid.UUID     `gorm:"type:uuid;index" json:"folder_id,omitempty"`
+	Filename      string         `gorm:"size=255;not null" json:"filename"`
+	Path          string         `gorm:"size=500;not null" json:"-"`
+	Size          int64          `gorm:"not null" json:"size"`
+	OriginalSize  int64          `gorm:"not null;default:0" json:"original_size"`
+	MimeType      string         `gorm:"size:255" json:"mime_type"`
+	SHA256        string         `gorm:"size:64" json:"sha256,omitempty"`
+	ScanStatus    string         `gorm:"size:20;not null;default:pending;index" json:"scan_status"`
+	ScanResult    string         `gorm:"size:255" json:"scan_result,omitempty"`
+	Version       int            `gorm:"not null;default:1" json:"version"`
+	Tags          []FileTag      `gorm:"foreignKey:FileID;constraint:OnDelete:CASCADE" json:"tags,omitempty"`
+	Metadata      []byte         `json:"-"`
+	Description   string         `gorm:"-" json:"description,omitempty"`
+	Properties    Properties     `gorm:"-" json:"properties,omitempty"`
+	ExpiresAt     *time.Time     `gorm:"index" json:"expires_at,omitempty"`
+	LegalHold     bool           `gorm:"not null;default:false" json:"legal_hold"`
+	RetainUntil   *time.Time     `json:"retain_until,omitempty"`
+	RetentionFrom *time.Time     `json:"retention_from,omitempty"`
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+	DeletedAt     gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
 }
+
+// Properties are custom key/value metadata on a file, e.g. project, ticket or build number
+type Properties map[string]string
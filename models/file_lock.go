@@ -0,0 +1,16 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FileLock checks a file out to one user until ExpiresAt. While it is in force, writes to the file by
+// anyone else are rejected. Expired locks are simply ignored and overwritten by the next lock.
+type FileLock struct {
+	FileID    uuid.UUID `gorm:"type:uuid;primaryKey" json:"file_id"`
+	UserID    uint      `gorm:"not null;index" json:"user_id"`
+	ExpiresAt time.Time `gorm:"not null" json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FilePreview is a small derived rendition of a file version (an image thumbnail or the first lines of a text file).
+// Previews are encrypted under the same password as the version they belong to. Like versions, their
+// ciphertext checksum is recorded at write time and re-checked by the scrubber.
+type FilePreview struct {
+	ID         uuid.UUID  `gorm:"type:uuid;default:uuid_generate_v4();primaryKey" json:"id"`
+	FileID     uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_file_previews_kind" json:"file_id"`
+	Version    int        `gorm:"not null;uniqueIndex:idx_file_previews_kind" json:"version"`
+	Kind       string     `gorm:"size:20;not null;uniqueIndex:idx_file_previews_kind" json:"kind"` // thumb_64, thumb_256, thumb_512 or text
+	MimeType   string     `gorm:"size:100;not null" json:"mime_type"`
+	Path       string     `gorm:"size:500;not null" json:"-"`
+	BlobSHA256 string     `gorm:"size:64" json:"blob_sha256,omitempty"`
+	Integrity  string     `gorm:"size:20;not null;default:unverified;index" json:"integrity"`
+	CheckedAt  *time.Time `json:"checked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FileRequest is an upload-only link: anyone holding its token can add files to Folder without
+// seeing what is in it. Uploads are encrypted under a password the owner chose for the request; the
+// server keeps only a key derived from it (KeySalt, SealedKEK), sealed under a server secret.
+type FileRequest struct {
+	ID              uuid.UUID  `gorm:"type:uuid;default:uuid_generate_v4();primaryKey" json:"id"`
+	TokenHash       string     `gorm:"size:64;uniqueIndex;not null" json:"-"`
+	Token           string     `gorm:"-" json:"token,omitempty"` // only set when the request is created
+	OwnerID         uint       `gorm:"not null;index" json:"owner_id"`
+	FolderID        uuid.UUID  `gorm:"type:uuid;not null;index" json:"folder_id"`
+	Folder          Folder     `gorm:"constraint:OnDelete:CASCADE" json:"-"`
+	Title           string     `gorm:"size:255" json:"title"`
+	ExpiresAt       *time.Time `json:"expires_at,omitempty"`
+	MaxFiles        *int       `json:"max_files,omitempty"`
+	MaxFileSize     int64      `gorm:"not null;default:0" json:"max_file_size"`        // bytes, 0 = no limit
+	AllowedTypes    StringList `gorm:"type:text" json:"allowed_types,omitempty"`       // extensions (".pdf") or MIME types ("image/*")
+	RequireUploader bool       `gorm:"not null;default:false" json:"require_uploader"` // uploader name or email must be given
+	Uploads         int        `gorm:"not null;default:0" json:"uploads"`
+	Disabled        bool       `gorm:"not null;default:false" json:"disabled"`
+	KeySalt         []byte     `json:"-"`
+	SealedKEK       []byte     `json:"-"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
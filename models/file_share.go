@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Permissions a FileShare can grant; each includes the ones before it
+const (
+	PermissionView     = "view"     // see the file and its metadata under shared-with-me
+	PermissionDownload = "download" // also download it
+	PermissionEdit     = "edit"     // also upload versions, rename, edit metadata and check the file out
+	PermissionManage   = "manage"   // also grant and revoke other people's access
+)
+
+// FileShare grants a named user access to a file; no bearer token is involved.
+// A share for an address without an account is a pending invitation (GranteeID nil). It carries an
+// invitation token, returned once to the person sharing and stored only as InviteHash; the account
+// registered with that email claims the share by presenting it. Downloading still needs a secret: the file password, or the
+// share's own password when it carries a copy of a version's data key (KeyID), as protected links do.
+type FileShare struct {
+	ID          uuid.UUID     `gorm:"type:uuid;default:uuid_generate_v4();primaryKey" json:"id"`
+	FileID      uuid.UUID     `gorm:"type:uuid;not null;uniqueIndex:idx_file_shares_file_email" json:"file_id"`
+	File        EncryptedFile `gorm:"constraint:OnDelete:CASCADE" json:"-"`
+	Email       string        `gorm:"size:120;not null;uniqueIndex:idx_file_shares_file_email;index" json:"email"`
+	GranteeID   *uint         `gorm:"index" json:"grantee_id,omitempty"`
+	InviteHash  string        `gorm:"size:64;index" json:"-"`
+	InviteToken string        `gorm:"-" json:"invite_token,omitempty"`
+	Permission  string        `gorm:"size:20;not null" json:"permission"`
+	ExpiresAt   *time.Time    `json:"expires_at,omitempty"`
+	GrantedBy   uint          `gorm:"not null" json:"granted_by"`
+	Version     *int          `json:"version,omitempty"` // set when the share carries its own password
+	KeyID       *uuid.UUID    `gorm:"type:uuid" json:"-"`
+	KeySalt     []byte        `json:"-"`
+	WrappedKey  []byte        `json:"-"`
+	CreatedAt   time.Time     `json:"created_at"`
+	UpdatedAt   time.Time     `json:"updated_at"`
+}
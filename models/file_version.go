@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Integrity states of a stored blob, maintained by the background scrubber
+const (
+	IntegrityUnverified = "unverified" // no checksum recorded yet (blob written before checksums existed)
+	IntegrityOK         = "ok"
+	IntegrityCorrupt    = "corrupt"
+	IntegrityMissing    = "missing"
+)
+
+// FileVersion is one stored revision of an EncryptedFile.
+// Every version has its own encrypted blob on disk; EncryptedFile.Path always points at the latest one.
+// BlobSHA256 is the checksum of the ciphertext on disk, recorded at write time and re-checked by the scrubber.
+type FileVersion struct {
+	ID           uuid.UUID  `gorm:"type:uuid;default:uuid_generate_v4();primaryKey" json:"id"`
+	FileID       uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_file_versions_file_version" json:"file_id"`
+	Version      int        `gorm:"not null;uniqueIndex:idx_file_versions_file_version" json:"version"`
+	Path         string     `gorm:"size:500;not null" json:"-"`
+	Size         int64      `gorm:"not null" json:"size"`
+	OriginalSize int64      `gorm:"not null;default:0" json:"original_size"`
+	MimeType     string     `gorm:"size:255" json:"mime_type"`
+	SHA256       string     `gorm:"size:64" json:"sha256,omitempty"`
+	BlobSHA256   string     `gorm:"size:64" json:"blob_sha256,omitempty"`
+	ScanStatus   string     `gorm:"size:20;not null;default:pending" json:"scan_status"`
+	ScanResult   string     `gorm:"size:255" json:"scan_result,omitempty"`
+	Integrity    string     `gorm:"size:20;not null;default:unverified;index" json:"integrity"`
+	CheckedAt    *time.Time `json:"checked_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// VersionPolicy is the per-user retention rule for old file versions.
+// Zero values mean "no limit"; the current version is never pruned.
+type VersionPolicy struct {
+	UserID       uint      `gorm:"primaryKey" json:"user_id"`
+	KeepVersions int       `gorm:"not null;default:0" json:"keep_versions"`
+	KeepDays     int       `gorm:"not null;default:0" json:"keep_days"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
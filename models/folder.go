@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Folder groups files of one owner. Folders may be nested through ParentID.
+// LegalHold and RetainUntil lock every file in the folder and its sub-folders.
+// RetentionDays, when non-zero, expires files placed directly in the folder that many days after upload (or restore from the trash).
+type Folder struct {
+	ID            uuid.UUID  `gorm:"type:uuid;default:uuid_generate_v4();primaryKey" json:"id"`
+	OwnerID       uint       `gorm:"not null;index" json:"owner_id"`
+	Name          string     `gorm:"size:255;not null" json:"name"`
+	ParentID      *uuid.UUID `gorm:"type:uuid;index" json:"parent_id,omitempty"`
+	RetentionDays int        `gorm:"not null;default:0" json:"retention_days"`
+	LegalHold     bool       `gorm:"not null;default:false" json:"legal_hold"`
+	RetainUntil   *time.Time `json:"retain_until,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// FileTag is a free-form label attached to a file
+type FileTag struct {
+	FileID uuid.UUID `gorm:"type:uuid;primaryKey" json:"-"`
+	Tag    string    `gorm:"size:64;primaryKey" json:"tag"`
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// RetentionPolicy is the per-user rule for expiring files: files are moved to the trash
+// DeleteAfterDays after upload (0 = keep forever). An explicit EncryptedFile.ExpiresAt or a
+// folder's RetentionDays takes precedence over it.
+type RetentionPolicy struct {
+	UserID          uint      `gorm:"primaryKey" json:"user_id"`
+	DeleteAfterDays int       `gorm:"not null;default:0" json:"delete_after_days"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
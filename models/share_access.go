@@ -0,0 +1,54 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// What a share access asked for
+const (
+	ShareActionDownload = "download" // one file, through a file link or a folder link
+	ShareActionArchive  = "archive"  // a whole shared folder
+	ShareActionList     = "list"     // a shared folder's listing
+	ShareActionInfo     = "info"     // the public metadata shown before a download
+)
+
+// How a share access ended
+const (
+	AccessCompleted  = "completed"  // the whole file or archive was sent, or the listing shown
+	AccessIncomplete = "incomplete" // the client went away before the end; it does not count as a download
+	AccessDenied     = "denied"     // refused by the link's state or restrictions; Reason says why
+	AccessFailed     = "failed"     // wrong password, or the file could not be opened
+)
+
+// ShareAccess records one attempt to use a share link. Rows outlive the link, so per-file
+// statistics keep the history of revoked links.
+type ShareAccess struct {
+	ID         uuid.UUID  `gorm:"type:uuid;default:uuid_generate_v4();primaryKey" json:"id"`
+	LinkID     uuid.UUID  `gorm:"type:uuid;not null;index" json:"link_id"`
+	FileID     *uuid.UUID `gorm:"type:uuid;index" json:"file_id,omitempty"` // the file served, if any
+	Action     string     `gorm:"size:20;not null" json:"action"`
+	Outcome    string     `gorm:"size:20;not null" json:"outcome"`
+	Reason     string     `gorm:"size:50" json:"reason,omitempty"`
+	IP         string     `gorm:"size:64" json:"ip"`
+	UserAgent  string     `gorm:"size:512" json:"user_agent,omitempty"`
+	BytesSent  int64      `gorm:"not null;default:0" json:"bytes_sent"`
+	StartedAt  time.Time  `gorm:"not null;index" json:"started_at"`
+	DurationMs int64      `gorm:"not null;default:0" json:"duration_ms"`
+}
+
+// ShareAccessStats summarizes the accesses of a link or of every link to a file
+type ShareAccessStats struct {
+	Attempts       int64            `json:"attempts"`
+	Completed      int64            `json:"completed"`
+	Incomplete     int64            `json:"incomplete"`
+	Denied         int64            `json:"denied"`
+	Failed         int64            `json:"failed"`
+	DeniedByReason map[string]int64 `json:"denied_by_reason"`
+	BytesSent      int64            `json:"bytes_sent"`
+	UniqueIPs      int64            `json:"unique_ips"`
+	AvgDurationMs  int64            `json:"avg_duration_ms"` // of completed accesses
+	FirstAccess    *time.Time       `json:"first_access,omitempty"`
+	LastAccess     *time.Time       `json:"last_access,omitempty"`
+}
@@ -1,20 +1,91 @@
 package models
 
 import (
+	"database/sql/driver"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+// Share link protection modes
+const (
+	ProtectFilePassword  = "file_password"
+	ProtectSharePassword = "share_password"
+	ProtectURLKey        = "url_key"
+)
+
 // ShareLink represents a public share token for an encrypted file
-// Token is a URL-safe random string (primary key)
+// Token is a URL-safe random string. Only its SHA-256 (TokenHash) is stored; the token itself is handed
+// out once, when the link is created. Links are managed by their public ID.
+// Protection says which secret opens the file: the owner's file password, the link's own password, or a
+// random key carried in the URL fragment. Links with their own secret hold a copy of the pinned version's
+// data key (KeyID), wrapped under that secret with KeySalt; revoking the link destroys the copy.
+// A link points at either a file (FileID) or a folder (FolderID). A folder link exposes a listing of the
+// folder and its sub-folders as they are at the time of each request, and downloads of single files or
+// of the whole folder as an archive, each opened with the file password and counted like a file download.
+// Disabled links are kept (with their usage) but refuse downloads until re-enabled.
+// HideFilename keeps the file or folder name out of the public metadata shown before a download.
 type ShareLink struct {
-	Token         string        `gorm:"primaryKey;size:64" json:"token"`
-	FileID        uuid.UUID     `gorm:"type:uuid;not null" json:"file_id"`
+	ID            uuid.UUID     `gorm:"type:uuid;default:uuid_generate_v4();primaryKey" json:"id"`
+	TokenHash     string        `gorm:"size:64;not null;uniqueIndex" json:"-"`
+	Token         string        `gorm:"-" json:"token,omitempty"`
+	FileID        *uuid.UUID    `gorm:"type:uuid;index" json:"file_id,omitempty"`
 	File          EncryptedFile `gorm:"constraint:OnDelete:CASCADE" json:"-"`
+	FolderID      *uuid.UUID    `gorm:"type:uuid;index" json:"folder_id,omitempty"`
+	Folder        Folder        `gorm:"constraint:OnDelete:CASCADE" json:"-"`
+	Version       *int          `json:"version,omitempty"` // pinned file version; nil follows the latest
 	ExpiresAt     *time.Time    `json:"expires_at,omitempty"`
 	MaxDownloads  *int          `json:"max_downloads,omitempty"`
 	Downloads     int           `json:"downloads"`
-	CreatedByUser uint          `json:"created_by_user"`
+	Disabled      bool          `gorm:"not null;default:false" json:"disabled"`
+	HideFilename  bool          `gorm:"not null;default:false" json:"hide_filename"`
+	Protection    string        `gorm:"size:20;not null;default:file_password" json:"protection"`
+	KeyID         *uuid.UUID    `gorm:"type:uuid" json:"-"`
+	KeySalt       []byte        `json:"-"`
+	WrappedKey    []byte        `json:"-"`
+	CreatedByUser uint          `gorm:"index" json:"created_by_user"`
 	CreatedAt     time.Time     `json:"created_at"`
+
+	Restrictions ShareRestrictions `gorm:"embedded" json:"restrictions"`
+}
+
+// ShareRestrictions are optional conditions on when and from where a link may be used.
+// Empty fields do not restrict. Weekdays and hours are evaluated in TimeZone (UTC when empty);
+// the hour window [HoursFrom, HoursTo) wraps past midnight when HoursFrom > HoursTo.
+// AllowedOrigins are matched against the request's Origin header, or the origin of its Referer.
+type ShareRestrictions struct {
+	AllowedCIDRs    StringList `gorm:"type:text" json:"allowed_cidrs,omitempty"`
+	NotBefore       *time.Time `json:"not_before,omitempty"`
+	AllowedWeekdays StringList `gorm:"type:text" json:"allowed_weekdays,omitempty"` // "mon" … "sun"
+	HoursFrom       *int       `json:"hours_from,omitempty"`
+	HoursTo         *int       `json:"hours_to,omitempty"`
+	TimeZone        string     `gorm:"size:64" json:"time_zone,omitempty"`
+	AllowedOrigins  StringList `gorm:"type:text" json:"allowed_origins,omitempty"`
+}
+
+// StringList is stored as comma-separated text; items must not contain commas
+type StringList []string
+
+func (l StringList) Value() (driver.Value, error) {
+	return strings.Join(l, ","), nil
+}
+
+func (l *StringList) Scan(src interface{}) error {
+	var s string
+	switch v := src.(type) {
+	case nil:
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	default:
+		return fmt.Errorf("cannot scan %T into StringList", src)
+	}
+	*l = nil
+	if s != "" {
+		*l = strings.Split(s, ",")
+	}
+	return nil
 }
@@ -6,13 +6,24 @@ import (
 	"gorm.io/gorm"
 )
 
+// Roles
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
 // User represents the users table
+// Role is "user" or "admin"; admins are promoted directly in the database.
+// CanManageHolds is a separate privilege, also granted in the database, that lets an admin place and
+// lift legal holds and retention locks.
 type User struct {
-	ID        uint           `gorm:"primaryKey" json:"id"`
-	Name      string         `gorm:"size=100;not null" json:"name"`
-	Email     string         `gorm:"size=120;uniqueIndex;not null" json:"email"`
-	Password  string         `gorm:"not null" json:"-"`
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	ID             uint           `gorm:"primaryKey" json:"id"`
+	Name           string         `gorm:"size=100;not null" json:"name"`
+	Email          string         `gorm:"size=120;uniqueIndex;not null" json:"email"`
+	Password       string         `gorm:"not null" json:"-"`
+	Role           string         `gorm:"size:20;not null;default:user" json:"role"`
+	CanManageHolds bool           `gorm:"not null;default:false" json:"-"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	DeletedAt      gorm.DeletedAt `gorm:"index" json:"-"`
 }
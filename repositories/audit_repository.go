@@ -0,0 +1,33 @@
+package repositories
+
+import (
+	"file_project/models"
+
+	"gorm.io/gorm"
+)
+
+type AuditRepository interface {
+	Create(entry *models.AuditLog) error
+	ListByUser(userID uint, limit int) ([]models.AuditLog, error)
+}
+
+type auditRepository struct {
+	db *gorm.DB
+}
+
+func NewAuditRepository(db *gorm.DB) AuditRepository {
+	return &auditRepository{db: db}
+}
+
+func (r *auditRepository) Create(entry *models.AuditLog) error {
+	return r.db.Create(entry).Error
+}
+
+// ListByUser returns the user's most recent audit entries, newest first
+func (r *auditRepository) ListByUser(userID uint, limit int) ([]models.AuditLog, error) {
+	var list []models.AuditLog
+	if err := r.db.Where("user_id = ?", userID).Order("created_at DESC").Limit(limit).Find(&list).Error; err != nil {
+		return nil, err
+	}
+	return list, nil
+}
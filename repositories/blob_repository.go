@@ -0,0 +1,106 @@
+package repositories
+
+import (
+	"errors"
+
+	"file_project/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type BlobRepository interface {
+	Create(b *models.Blob) error
+	FindByKey(ownerID uint, key string) (*models.Blob, error)
+	IsTracked(path string) (bool, error)
+	AddRef(id uuid.UUID) (bool, error)
+	Release(path string) (int64, bool, error)
+	Stats(ownerID uint) (int64, int64, error)
+	GetSetting(userID uint) (*models.DedupSetting, error)
+	SaveSetting(s *models.DedupSetting) error
+}
+
+type blobRepository struct {
+	db *gorm.DB
+}
+
+func NewBlobRepository(db *gorm.DB) BlobRepository {
+	return &blobRepository{db: db}
+}
+
+func (r *blobRepository) Create(b *models.Blob) error {
+	return r.db.Create(b).Error
+}
+
+func (r *blobRepository) FindByKey(ownerID uint, key string) (*models.Blob, error) {
+	var b models.Blob
+	if err := r.db.Where("owner_id = ? AND dedup_key = ?", ownerID, key).First(&b).Error; err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// IsTracked reports whether path is a reference-counted blob
+func (r *blobRepository) IsTracked(path string) (bool, error) {
+	var count int64
+	if err := r.db.Model(&models.Blob{}).Where("path = ?", path).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// AddRef takes a reference on a blob. It fails (false) once the blob's last reference is gone,
+// so a blob that is being deleted cannot be revived.
+func (r *blobRepository) AddRef(id uuid.UUID) (bool, error) {
+	res := r.db.Model(&models.Blob{}).Where("id = ? AND ref_count > 0", id).UpdateColumn("ref_count", gorm.Expr("ref_count + 1"))
+	return res.RowsAffected == 1, res.Error
+}
+
+// Release drops one reference on the blob at path and returns the references left.
+// tracked is false when path is not a deduplicated blob. The row is removed at zero.
+func (r *blobRepository) Release(path string) (int64, bool, error) {
+	var b models.Blob
+	res := r.db.Model(&b).Clauses(clause.Returning{}).Where("path = ? AND ref_count > 0", path).UpdateColumn("ref_count", gorm.Expr("ref_count - 1"))
+	if res.Error != nil {
+		return 0, false, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return 0, false, nil
+	}
+	if b.RefCount <= 0 {
+		if err := r.db.Where("id = ? AND ref_count <= 0", b.ID).Delete(&models.Blob{}).Error; err != nil {
+			return 0, true, err
+		}
+	}
+	return b.RefCount, true, nil
+}
+
+// Stats returns how many of the owner's blobs are shared and how many bytes sharing saves
+func (r *blobRepository) Stats(ownerID uint) (int64, int64, error) {
+	var row struct {
+		Shared int64
+		Saved  int64
+	}
+	err := r.db.Model(&models.Blob{}).
+		Select("COUNT(*) FILTER (WHERE ref_count > 1) AS shared, COALESCE(SUM((ref_count - 1) * size), 0) AS saved").
+		Where("owner_id = ?", ownerID).Scan(&row).Error
+	return row.Shared, row.Saved, err
+}
+
+// GetSetting returns the user's dedup setting, or a disabled one if none is stored
+func (r *blobRepository) GetSetting(userID uint) (*models.DedupSetting, error) {
+	var s models.DedupSetting
+	err := r.db.Where("user_id = ?", userID).First(&s).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &models.DedupSetting{UserID: userID}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (r *blobRepository) SaveSetting(s *models.DedupSetting) error {
+	return r.db.Clauses(clause.OnConflict{UpdateAll: true}).Create(s).Error
+}
@@ -0,0 +1,65 @@
+package repositories
+
+import (
+	"file_project/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type DataKeyRepository interface {
+	Create(k *models.DataKey) error
+	FindByID(id uuid.UUID) (*models.DataKey, error)
+	Update(k *models.DataKey) error
+	AddRef(id uuid.UUID) error
+	Release(id uuid.UUID) (int64, error)
+}
+
+type dataKeyRepository struct {
+	db *gorm.DB
+}
+
+func NewDataKeyRepository(db *gorm.DB) DataKeyRepository {
+	return &dataKeyRepository{db: db}
+}
+
+func (r *dataKeyRepository) Create(k *models.DataKey) error {
+	return r.db.Create(k).Error
+}
+
+func (r *dataKeyRepository) FindByID(id uuid.UUID) (*models.DataKey, error) {
+	var k models.DataKey
+	if err := r.db.Where("id = ?", id).First(&k).Error; err != nil {
+		return nil, err
+	}
+	return &k, nil
+}
+
+func (r *dataKeyRepository) Update(k *models.DataKey) error {
+	return r.db.Save(k).Error
+}
+
+func (r *dataKeyRepository) AddRef(id uuid.UUID) error {
+	res := r.db.Model(&models.DataKey{}).Where("id = ? AND ref_count > 0", id).UpdateColumn("ref_count", gorm.Expr("ref_count + 1"))
+	if res.Error == nil && res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return res.Error
+}
+
+// Release drops one reference on a key and deletes the key once no blob uses it.
+// It returns the references left; a key that no longer exists counts as zero.
+func (r *dataKeyRepository) Release(id uuid.UUID) (int64, error) {
+	var k models.DataKey
+	res := r.db.Model(&k).Clauses(clause.Returning{}).Where("id = ? AND ref_count > 0", id).UpdateColumn("ref_count", gorm.Expr("ref_count - 1"))
+	if res.Error != nil || res.RowsAffected == 0 {
+		return 0, res.Error
+	}
+	if k.RefCount <= 0 {
+		if err := r.db.Where("id = ? AND ref_count <= 0", id).Delete(&models.DataKey{}).Error; err != nil {
+			return 0, err
+		}
+	}
+	return k.RefCount, nil
+}
@@ -0,0 +1,124 @@
+package repositories
+
+import (
+	"time"
+
+	"file_project/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type FilePreviewRepository interface {
+	Create(p *models.FilePreview) error
+	Find(fileID uuid.UUID, version int, kind string) (*models.FilePreview, error)
+	ListByVersion(fileID uuid.UUID, version int) ([]models.FilePreview, error)
+	ListByFile(fileID uuid.UUID) ([]models.FilePreview, error)
+	FindByID(id uuid.UUID) (*models.FilePreview, error)
+	ListPage(afterID uuid.UUID, limit int) ([]models.FilePreview, error)
+	ListByIntegrity(statuses []string) ([]models.FilePreview, error)
+	CountByIntegrity() (map[string]int64, error)
+	SetChecksum(id uuid.UUID, path, checksum string, checkedAt time.Time) error
+	SetIntegrity(id uuid.UUID, path, checksum, integrity string, checkedAt time.Time) (bool, error)
+	DeleteByVersion(fileID uuid.UUID, version int) error
+	DeleteByFile(fileID uuid.UUID) error
+}
+
+type filePreviewRepository struct {
+	db *gorm.DB
+}
+
+func NewFilePreviewRepository(db *gorm.DB) FilePreviewRepository {
+	return &filePreviewRepository{db: db}
+}
+
+func (r *filePreviewRepository) Create(p *models.FilePreview) error {
+	return r.db.Create(p).Error
+}
+
+func (r *filePreviewRepository) Find(fileID uuid.UUID, version int, kind string) (*models.FilePreview, error) {
+	var p models.FilePreview
+	if err := r.db.Where("file_id = ? AND version = ? AND kind = ?", fileID, version, kind).First(&p).Error; err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (r *filePreviewRepository) ListByVersion(fileID uuid.UUID, version int) ([]models.FilePreview, error) {
+	var list []models.FilePreview
+	if err := r.db.Where("file_id = ? AND version = ?", fileID, version).Order("kind").Find(&list).Error; err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (r *filePreviewRepository) ListByFile(fileID uuid.UUID) ([]models.FilePreview, error) {
+	var list []models.FilePreview
+	if err := r.db.Where("file_id = ?", fileID).Find(&list).Error; err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (r *filePreviewRepository) FindByID(id uuid.UUID) (*models.FilePreview, error) {
+	var p models.FilePreview
+	if err := r.db.Where("id = ?", id).First(&p).Error; err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// ListPage returns up to limit previews of all files with an ID greater than afterID (keyset pagination)
+func (r *filePreviewRepository) ListPage(afterID uuid.UUID, limit int) ([]models.FilePreview, error) {
+	var list []models.FilePreview
+	if err := r.db.Where("id > ?", afterID).Order("id").Limit(limit).Find(&list).Error; err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (r *filePreviewRepository) ListByIntegrity(statuses []string) ([]models.FilePreview, error) {
+	var list []models.FilePreview
+	if err := r.db.Where("integrity IN ?", statuses).Order("checked_at DESC").Find(&list).Error; err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (r *filePreviewRepository) CountByIntegrity() (map[string]int64, error) {
+	var rows []struct {
+		Integrity string
+		Count     int64
+	}
+	if err := r.db.Model(&models.FilePreview{}).Select("integrity, COUNT(*) AS count").Group("integrity").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	out := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		out[row.Integrity] = row.Count
+	}
+	return out, nil
+}
+
+// SetChecksum records the checksum of a preview blob that was just rewritten in place
+func (r *filePreviewRepository) SetChecksum(id uuid.UUID, path, checksum string, checkedAt time.Time) error {
+	return r.db.Model(&models.FilePreview{}).
+		Where("id = ? AND path = ?", id, path).
+		Updates(map[string]interface{}{"integrity": models.IntegrityOK, "checked_at": checkedAt, "blob_sha256": checksum}).Error
+}
+
+// SetIntegrity records a scrub result for a preview, with the same guard as for file versions
+func (r *filePreviewRepository) SetIntegrity(id uuid.UUID, path, checksum, integrity string, checkedAt time.Time) (bool, error) {
+	res := r.db.Model(&models.FilePreview{}).
+		Where("id = ? AND path = ? AND (blob_sha256 = ? OR blob_sha256 = '')", id, path, checksum).
+		Updates(map[string]interface{}{"integrity": integrity, "checked_at": checkedAt, "blob_sha256": checksum})
+	return res.RowsAffected > 0, res.Error
+}
+
+func (r *filePreviewRepository) DeleteByVersion(fileID uuid.UUID, version int) error {
+	return r.db.Where("file_id = ? AND version = ?", fileID, version).Delete(&models.FilePreview{}).Error
+}
+
+func (r *filePreviewRepository) DeleteByFile(fileID uuid.UUID) error {
+	return r.db.Where("file_id = ?", fileID).Delete(&models.FilePreview{}).Error
+}
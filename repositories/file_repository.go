@@ -1,18 +1,44 @@
 package repositories
 
 import (
+	"errors"
+	"time"
+
 	"file_project/models"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type FileRepository interface {
 	Create(file *models.EncryptedFile) error
 	FindByID(id uuid.UUID, ownerID uint) (*models.EncryptedFile, error)
 	ListByOwner(ownerID uint) ([]models.EncryptedFile, error)
+	ListByFolder(ownerID uint, folderID uuid.UUID) ([]models.EncryptedFile, error)
 	Delete(id uuid.UUID, ownerID uint) error
-	Update(file *models.EncryptedFile) error
+	Update(file *models.EncryptedFile, fields ...string) error
+	ListTrash(ownerID uint) ([]models.EncryptedFile, error)
+	FindTrashed(id uuid.UUID, ownerID uint) (*models.EncryptedFile, error)
+	ListTrashedBefore(cutoff time.Time) ([]models.EncryptedFile, error)
+	Restore(id uuid.UUID, ownerID uint) error
+	Purge(id uuid.UUID, ownerID uint) error
+	ListMissingOriginalSize() ([]models.EncryptedFile, error)
+	SetOriginalSize(id uuid.UUID, size int64) error
+	CommitVersion(file *models.EncryptedFile, previous int) (bool, error)
+	ListWithMetadata() ([]models.EncryptedFile, error)
+	ReplaceMetadata(id uuid.UUID, old, sealed []byte) (bool, error)
+	AddTags(fileID uuid.UUID, tags []string) error
+	RemoveTags(fileID uuid.UUID, tags []string) error
+	ListExpired(now time.Time) ([]models.EncryptedFile, error)
+	ListInFolderRetainedBefore(folderID uuid.UUID, cutoff time.Time) ([]models.EncryptedFile, error)
+	ListUnruledRetainedBefore(ownerID uint, cutoff time.Time) ([]models.EncryptedFile, error)
+	FindAny(id uuid.UUID) (*models.EncryptedFile, error)
+	SetHold(id uuid.UUID, legalHold bool, retainUntil *time.Time) error
+	ListHeld(now time.Time) ([]models.EncryptedFile, error)
+	AcquireLock(lock *models.FileLock, now time.Time) (bool, error)
+	FindLock(fileID uuid.UUID) (*models.FileLock, error)
+	ReleaseLock(fileID uuid.UUID) error
 }
 
 type fileRepository struct {
@@ -37,7 +63,15 @@ func (r *fileRepository) FindByID(id uuid.UUID, ownerID uint) (*models.Encrypted
 
 func (r *fileRepository) ListByOwner(ownerID uint) ([]models.EncryptedFile, error) {
 	var list []models.EncryptedFile
-	if err := r.db.Where("owner_id = ?", ownerID).Order("created_at DESC").Find(&list).Error; err != nil {
+	if err := r.db.Preload("Tags").Where("owner_id = ?", ownerID).Order("created_at DESC").Find(&list).Error; err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (r *fileRepository) ListByFolder(ownerID uint, folderID uuid.UUID) ([]models.EncryptedFile, error) {
+	var list []models.EncryptedFile
+	if err := r.db.Where("owner_id = ? AND folder_id = ?", ownerID, folderID).Order("filename").Find(&list).Error; err != nil {
 		return nil, err
 	}
 	return list, nil
@@ -47,6 +81,196 @@ func (r *fileRepository) Delete(id uuid.UUID, ownerID uint) error {
 	return r.db.Where("id = ? AND owner_id = ?", id, ownerID).Delete(&models.EncryptedFile{}).Error
 }
 
-func (r *fileRepository) Update(file *models.EncryptedFile) error {
-	return r.db.Save(file).Error
+// Update writes only the named fields of file (Go field names), so concurrent changes to other columns,
+// such as a legal hold or the trash, are never overwritten with values read earlier. A file that is
+// trashed or gone is left alone and reported as gorm.ErrRecordNotFound.
+func (r *fileRepository) Update(file *models.EncryptedFile, fields ...string) error {
+	if len(fields) == 0 {
+		return errors.New("update of file " + file.ID.String() + " names no fields")
+	}
+	cols := append(append([]string{}, fields...), "UpdatedAt")
+	res := r.db.Model(&models.EncryptedFile{}).Where("id = ?", file.ID).Select(cols).Updates(file)
+	if res.Error == nil && res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return res.Error
+}
+
+// CommitVersion makes file's version, blob and content columns current, but only while the file is still
+// at version previous. It reports false when another version was committed first.
+func (r *fileRepository) CommitVersion(file *models.EncryptedFile, previous int) (bool, error) {
+	res := r.db.Model(&models.EncryptedFile{}).Where("id = ? AND version = ?", file.ID, previous).
+		Select("Version", "Path", "Size", "OriginalSize", "MimeType", "SHA256", "ScanStatus", "ScanResult", "UpdatedAt").
+		Updates(file)
+	return res.RowsAffected > 0, res.Error
+}
+
+// SetOriginalSize records the plaintext size of a file, trashed or not
+func (r *fileRepository) SetOriginalSize(id uuid.UUID, size int64) error {
+	return r.db.Unscoped().Model(&models.EncryptedFile{}).Where("id = ?", id).UpdateColumn("original_size", size).Error
+}
+
+// ListTrash returns soft-deleted files for owner, most recently trashed first
+func (r *fileRepository) ListTrash(ownerID uint) ([]models.EncryptedFile, error) {
+	var list []models.EncryptedFile
+	if err := r.db.Unscoped().Where("owner_id = ? AND deleted_at IS NOT NULL", ownerID).Order("deleted_at DESC").Find(&list).Error; err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (r *fileRepository) FindTrashed(id uuid.UUID, ownerID uint) (*models.EncryptedFile, error) {
+	var f models.EncryptedFile
+	if err := r.db.Unscoped().Where("id = ? AND owner_id = ? AND deleted_at IS NOT NULL", id, ownerID).First(&f).Error; err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// ListTrashedBefore returns files of all owners that were trashed before cutoff
+func (r *fileRepository) ListTrashedBefore(cutoff time.Time) ([]models.EncryptedFile, error) {
+	var list []models.EncryptedFile
+	if err := r.db.Unscoped().Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).Find(&list).Error; err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// Restore takes a file out of the trash and restarts its retention clock
+func (r *fileRepository) Restore(id uuid.UUID, ownerID uint) error {
+	return r.db.Unscoped().Model(&models.EncryptedFile{}).Where("id = ? AND owner_id = ?", id, ownerID).
+		Updates(map[string]interface{}{"deleted_at": nil, "retention_from": time.Now()}).Error
+}
+
+// Purge removes the row for good; share links go with it through the cascading foreign key
+func (r *fileRepository) Purge(id uuid.UUID, ownerID uint) error {
+	if err := r.db.Where("file_id = ?", id).Delete(&models.FileTag{}).Error; err != nil {
+		return err
+	}
+	if err := r.ReleaseLock(id); err != nil {
+		return err
+	}
+	return r.db.Unscoped().Where("id = ? AND owner_id = ?", id, ownerID).Delete(&models.EncryptedFile{}).Error
+}
+
+// ListMissingOriginalSize returns files (including trashed ones) whose plaintext size was never recorded
+func (r *fileRepository) ListMissingOriginalSize() ([]models.EncryptedFile, error) {
+	var list []models.EncryptedFile
+	if err := r.db.Unscoped().Where("original_size = 0").Find(&list).Error; err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// ListWithMetadata returns files (including trashed ones) that carry sealed metadata
+func (r *fileRepository) ListWithMetadata() ([]models.EncryptedFile, error) {
+	var list []models.EncryptedFile
+	if err := r.db.Unscoped().Where("metadata IS NOT NULL").Find(&list).Error; err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// ReplaceMetadata swaps a file's sealed metadata for sealed, unless it changed since old was read
+func (r *fileRepository) ReplaceMetadata(id uuid.UUID, old, sealed []byte) (bool, error) {
+	res := r.db.Unscoped().Model(&models.EncryptedFile{}).Where("id = ? AND metadata = ?", id, old).UpdateColumn("metadata", sealed)
+	return res.RowsAffected > 0, res.Error
+}
+
+func (r *fileRepository) AddTags(fileID uuid.UUID, tags []string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+	rows := make([]models.FileTag, 0, len(tags))
+	for _, t := range tags {
+		rows = append(rows, models.FileTag{FileID: fileID, Tag: t})
+	}
+	return r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&rows).Error
+}
+
+func (r *fileRepository) RemoveTags(fileID uuid.UUID, tags []string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+	return r.db.Where("file_id = ? AND tag IN ?", fileID, tags).Delete(&models.FileTag{}).Error
+}
+
+// ListExpired returns files of all users whose explicit expiry has passed
+func (r *fileRepository) ListExpired(now time.Time) ([]models.EncryptedFile, error) {
+	var list []models.EncryptedFile
+	if err := r.db.Where("expires_at IS NOT NULL AND expires_at <= ?", now).Find(&list).Error; err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// ListInFolderRetainedBefore returns files directly in folderID whose retention clock (the upload, or the
+// last restore from the trash) started before cutoff and that have no explicit expiry
+func (r *fileRepository) ListInFolderRetainedBefore(folderID uuid.UUID, cutoff time.Time) ([]models.EncryptedFile, error) {
+	var list []models.EncryptedFile
+	if err := r.db.Where("folder_id = ? AND expires_at IS NULL AND COALESCE(retention_from, created_at) < ?", folderID, cutoff).Find(&list).Error; err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// ListUnruledRetainedBefore returns files of owner whose retention clock started before cutoff that are
+// governed by neither an explicit expiry nor a folder retention rule
+func (r *fileRepository) ListUnruledRetainedBefore(ownerID uint, cutoff time.Time) ([]models.EncryptedFile, error) {
+	var list []models.EncryptedFile
+	err := r.db.Where("owner_id = ? AND expires_at IS NULL AND COALESCE(retention_from, created_at) < ?", ownerID, cutoff).
+		Where("folder_id IS NULL OR folder_id NOT IN (?)", r.db.Model(&models.Folder{}).Select("id").Where("retention_days > 0")).
+		Find(&list).Error
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// FindAny finds a file of any owner, including trashed ones (for admin use)
+func (r *fileRepository) FindAny(id uuid.UUID) (*models.EncryptedFile, error) {
+	var f models.EncryptedFile
+	if err := r.db.Unscoped().Where("id = ?", id).First(&f).Error; err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+func (r *fileRepository) SetHold(id uuid.UUID, legalHold bool, retainUntil *time.Time) error {
+	return r.db.Unscoped().Model(&models.EncryptedFile{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"legal_hold": legalHold, "retain_until": retainUntil}).Error
+}
+
+// ListHeld returns files of all users, including trashed ones, under a legal hold or an active retention lock
+func (r *fileRepository) ListHeld(now time.Time) ([]models.EncryptedFile, error) {
+	var list []models.EncryptedFile
+	if err := r.db.Unscoped().Where("legal_hold OR retain_until > ?", now).Order("owner_id, filename").Find(&list).Error; err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// AcquireLock takes or renews a lock in one statement. It fails (false) when another user holds a lock
+// that has not expired yet.
+func (r *fileRepository) AcquireLock(lock *models.FileLock, now time.Time) (bool, error) {
+	res := r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "file_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"user_id", "expires_at", "created_at"}),
+		Where: clause.Where{Exprs: []clause.Expression{
+			clause.Expr{SQL: "file_locks.expires_at <= ? OR file_locks.user_id = excluded.user_id", Vars: []interface{}{now}},
+		}},
+	}).Create(lock)
+	return res.RowsAffected == 1, res.Error
+}
+
+func (r *fileRepository) FindLock(fileID uuid.UUID) (*models.FileLock, error) {
+	var l models.FileLock
+	if err := r.db.Where("file_id = ?", fileID).First(&l).Error; err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+func (r *fileRepository) ReleaseLock(fileID uuid.UUID) error {
+	return r.db.Where("file_id = ?", fileID).Delete(&models.FileLock{}).Error
 }
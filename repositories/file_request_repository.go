@@ -0,0 +1,110 @@
+package repositories
+
+import (
+	"time"
+
+	"file_project/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type FileRequestRepository interface {
+	Create(req *models.FileRequest) error
+	FindByTokenHash(hash string) (*models.FileRequest, error)
+	FindByID(id uuid.UUID, ownerID uint) (*models.FileRequest, error)
+	ListByOwner(ownerID uint) ([]models.FileRequest, error)
+	Update(req *models.FileRequest) error
+	Delete(id uuid.UUID, ownerID uint) error
+	Claim(id uuid.UUID, now time.Time) (*models.FileRequest, error)
+	Unclaim(id uuid.UUID) error
+	ListAll() ([]models.FileRequest, error)
+	ReplaceSealedKEK(id uuid.UUID, old, sealed []byte) (bool, error)
+}
+
+type fileRequestRepository struct {
+	db *gorm.DB
+}
+
+func NewFileRequestRepository(db *gorm.DB) FileRequestRepository {
+	return &fileRequestRepository{db: db}
+}
+
+func (r *fileRequestRepository) Create(req *models.FileRequest) error {
+	return r.db.Create(req).Error
+}
+
+func (r *fileRequestRepository) FindByTokenHash(hash string) (*models.FileRequest, error) {
+	var req models.FileRequest
+	if err := r.db.Preload("Folder").Where("token_hash = ?", hash).First(&req).Error; err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+func (r *fileRequestRepository) FindByID(id uuid.UUID, ownerID uint) (*models.FileRequest, error) {
+	var req models.FileRequest
+	if err := r.db.Preload("Folder").Where("id = ? AND owner_id = ?", id, ownerID).First(&req).Error; err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+// ListByOwner returns a user's file requests, newest first
+func (r *fileRequestRepository) ListByOwner(ownerID uint) ([]models.FileRequest, error) {
+	var list []models.FileRequest
+	if err := r.db.Preload("Folder").Where("owner_id = ?", ownerID).Order("created_at DESC").Find(&list).Error; err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// Update saves whether the request is disabled, the only setting that can change after creation.
+// The upload counter is left to its own atomic statements.
+func (r *fileRequestRepository) Update(req *models.FileRequest) error {
+	return r.db.Model(req).Update("disabled", req.Disabled).Error
+}
+
+func (r *fileRequestRepository) Delete(id uuid.UUID, ownerID uint) error {
+	res := r.db.Where("id = ? AND owner_id = ?", id, ownerID).Delete(&models.FileRequest{})
+	if res.Error == nil && res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return res.Error
+}
+
+// Claim counts one upload in a single conditional UPDATE, so concurrent uploads can never
+// exceed max_files. It returns nil when the request is disabled, expired or full.
+func (r *fileRequestRepository) Claim(id uuid.UUID, now time.Time) (*models.FileRequest, error) {
+	var req models.FileRequest
+	res := r.db.Model(&req).Clauses(clause.Returning{}).
+		Where("id = ? AND NOT disabled", id).
+		Where("expires_at IS NULL OR expires_at > ?", now).
+		Where("max_files IS NULL OR uploads < max_files").
+		UpdateColumn("uploads", gorm.Expr("uploads + 1"))
+	if res.Error != nil || res.RowsAffected == 0 {
+		return nil, res.Error
+	}
+	return &req, nil
+}
+
+// Unclaim gives back an upload that was claimed but not stored
+func (r *fileRequestRepository) Unclaim(id uuid.UUID) error {
+	return r.db.Model(&models.FileRequest{}).Where("id = ? AND uploads > 0", id).UpdateColumn("uploads", gorm.Expr("uploads - 1")).Error
+}
+
+// ListAll returns the requests of all users
+func (r *fileRequestRepository) ListAll() ([]models.FileRequest, error) {
+	var list []models.FileRequest
+	if err := r.db.Find(&list).Error; err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// ReplaceSealedKEK swaps a request's sealed key for sealed, unless it changed since old was read
+func (r *fileRequestRepository) ReplaceSealedKEK(id uuid.UUID, old, sealed []byte) (bool, error) {
+	res := r.db.Model(&models.FileRequest{}).Where("id = ? AND sealed_kek = ?", id, old).UpdateColumn("sealed_kek", sealed)
+	return res.RowsAffected > 0, res.Error
+}
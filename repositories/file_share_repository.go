@@ -0,0 +1,90 @@
+package repositories
+
+import (
+	"time"
+
+	"file_project/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type FileShareRepository interface {
+	Upsert(share *models.FileShare) error
+	ListByFile(fileID uuid.UUID) ([]models.FileShare, error)
+	FindForGrantee(fileID uuid.UUID, granteeID uint, now time.Time) (*models.FileShare, error)
+	ListForGrantee(granteeID uint, now time.Time) ([]models.FileShare, error)
+	Delete(id, fileID uuid.UUID) error
+	ClaimInvite(inviteHash string, granteeID uint, email string) (*models.FileShare, error)
+}
+
+type fileShareRepository struct {
+	db *gorm.DB
+}
+
+func NewFileShareRepository(db *gorm.DB) FileShareRepository {
+	return &fileShareRepository{db: db}
+}
+
+// Upsert creates a share or replaces the one the file already has for the same email
+func (r *fileShareRepository) Upsert(share *models.FileShare) error {
+	return r.db.Omit(clause.Associations).Clauses(clause.Returning{}, clause.OnConflict{
+		Columns:   []clause.Column{{Name: "file_id"}, {Name: "email"}},
+		DoUpdates: clause.AssignmentColumns([]string{"grantee_id", "invite_hash", "permission", "expires_at", "granted_by", "version", "key_id", "key_salt", "wrapped_key", "updated_at"}),
+	}).Create(share).Error
+}
+
+func (r *fileShareRepository) ListByFile(fileID uuid.UUID) ([]models.FileShare, error) {
+	var list []models.FileShare
+	if err := r.db.Where("file_id = ?", fileID).Order("email").Find(&list).Error; err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// FindForGrantee returns the user's unexpired share of a file, with the file preloaded
+func (r *fileShareRepository) FindForGrantee(fileID uuid.UUID, granteeID uint, now time.Time) (*models.FileShare, error) {
+	var s models.FileShare
+	err := r.db.Preload("File").Where("file_id = ? AND grantee_id = ?", fileID, granteeID).
+		Where("expires_at IS NULL OR expires_at > ?", now).First(&s).Error
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// ListForGrantee returns the user's unexpired shares, newest first, with their files preloaded
+func (r *fileShareRepository) ListForGrantee(granteeID uint, now time.Time) ([]models.FileShare, error) {
+	var list []models.FileShare
+	err := r.db.Preload("File").Where("grantee_id = ?", granteeID).
+		Where("expires_at IS NULL OR expires_at > ?", now).Order("created_at DESC").Find(&list).Error
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (r *fileShareRepository) Delete(id, fileID uuid.UUID) error {
+	res := r.db.Where("id = ? AND file_id = ?", id, fileID).Delete(&models.FileShare{})
+	if res.Error == nil && res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return res.Error
+}
+
+// ClaimInvite hands the pending invitation with the given token hash to a user registered with its email.
+// The token works once.
+func (r *fileShareRepository) ClaimInvite(inviteHash string, granteeID uint, email string) (*models.FileShare, error) {
+	var share models.FileShare
+	res := r.db.Model(&share).Clauses(clause.Returning{}).
+		Where("invite_hash = ? AND grantee_id IS NULL AND email = ?", inviteHash, email).
+		Updates(map[string]interface{}{"grantee_id": granteeID, "invite_hash": ""})
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &share, nil
+}
@@ -0,0 +1,150 @@
+package repositories
+
+import (
+	"errors"
+	"time"
+
+	"file_project/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type FileVersionRepository interface {
+	Create(v *models.FileVersion) error
+	Update(v *models.FileVersion) error
+	SetIntegrity(id uuid.UUID, path, checksum, integrity string, checkedAt time.Time) (bool, error)
+	FindByID(id uuid.UUID) (*models.FileVersion, error)
+	ListPage(afterID uuid.UUID, limit int) ([]models.FileVersion, error)
+	ListByIntegrity(statuses []string) ([]models.FileVersion, error)
+	CountByIntegrity() (map[string]int64, error)
+	ListByFile(fileID uuid.UUID) ([]models.FileVersion, error)
+	FindByVersion(fileID uuid.UUID, version int) (*models.FileVersion, error)
+	Delete(id uuid.UUID) error
+	DeleteUnpinned(v *models.FileVersion) (bool, error)
+	DeleteByFile(fileID uuid.UUID) error
+	GetPolicy(userID uint) (*models.VersionPolicy, error)
+	SavePolicy(p *models.VersionPolicy) error
+}
+
+type fileVersionRepository struct {
+	db *gorm.DB
+}
+
+func NewFileVersionRepository(db *gorm.DB) FileVersionRepository {
+	return &fileVersionRepository{db: db}
+}
+
+func (r *fileVersionRepository) Create(v *models.FileVersion) error {
+	return r.db.Create(v).Error
+}
+
+func (r *fileVersionRepository) Update(v *models.FileVersion) error {
+	return r.db.Save(v).Error
+}
+
+// SetIntegrity records a scrub result for a version, but only while it still points at the blob that was
+// checked: same path, and a checksum that is either the one compared against or not yet recorded.
+// The checksum is stored as well. It reports false when the row changed or is gone.
+func (r *fileVersionRepository) SetIntegrity(id uuid.UUID, path, checksum, integrity string, checkedAt time.Time) (bool, error) {
+	res := r.db.Model(&models.FileVersion{}).
+		Where("id = ? AND path = ? AND (blob_sha256 = ? OR blob_sha256 = '')", id, path, checksum).
+		Updates(map[string]interface{}{"integrity": integrity, "checked_at": checkedAt, "blob_sha256": checksum})
+	return res.RowsAffected > 0, res.Error
+}
+
+func (r *fileVersionRepository) FindByID(id uuid.UUID) (*models.FileVersion, error) {
+	var v models.FileVersion
+	if err := r.db.Where("id = ?", id).First(&v).Error; err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// ListPage returns up to limit versions of all files with an ID greater than afterID (keyset pagination)
+func (r *fileVersionRepository) ListPage(afterID uuid.UUID, limit int) ([]models.FileVersion, error) {
+	var list []models.FileVersion
+	if err := r.db.Where("id > ?", afterID).Order("id").Limit(limit).Find(&list).Error; err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (r *fileVersionRepository) ListByIntegrity(statuses []string) ([]models.FileVersion, error) {
+	var list []models.FileVersion
+	if err := r.db.Where("integrity IN ?", statuses).Order("checked_at DESC").Find(&list).Error; err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (r *fileVersionRepository) CountByIntegrity() (map[string]int64, error) {
+	var rows []struct {
+		Integrity string
+		Count     int64
+	}
+	if err := r.db.Model(&models.FileVersion{}).Select("integrity, COUNT(*) AS count").Group("integrity").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	out := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		out[row.Integrity] = row.Count
+	}
+	return out, nil
+}
+
+// ListByFile returns all versions of a file, newest first
+func (r *fileVersionRepository) ListByFile(fileID uuid.UUID) ([]models.FileVersion, error) {
+	var list []models.FileVersion
+	if err := r.db.Where("file_id = ?", fileID).Order("version DESC").Find(&list).Error; err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (r *fileVersionRepository) FindByVersion(fileID uuid.UUID, version int) (*models.FileVersion, error) {
+	var v models.FileVersion
+	if err := r.db.Where("file_id = ? AND version = ?", fileID, version).First(&v).Error; err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+func (r *fileVersionRepository) Delete(id uuid.UUID) error {
+	return r.db.Where("id = ?", id).Delete(&models.FileVersion{}).Error
+}
+
+// DeleteUnpinned deletes a version unless a share link or a share with a named user is pinned to it.
+// It reports whether the version was deleted.
+func (r *fileVersionRepository) DeleteUnpinned(v *models.FileVersion) (bool, error) {
+	pinned := func(model interface{}) *gorm.DB {
+		return r.db.Model(model).Select("1").Where("file_id = ? AND version = ?", v.FileID, v.Version)
+	}
+	res := r.db.Where("id = ?", v.ID).
+		Where("NOT EXISTS (?)", pinned(&models.ShareLink{})).
+		Where("NOT EXISTS (?)", pinned(&models.FileShare{})).
+		Delete(&models.FileVersion{})
+	return res.RowsAffected > 0, res.Error
+}
+
+func (r *fileVersionRepository) DeleteByFile(fileID uuid.UUID) error {
+	return r.db.Where("file_id = ?", fileID).Delete(&models.FileVersion{}).Error
+}
+
+// GetPolicy returns the user's retention policy, or an empty (keep everything) policy if none is set
+func (r *fileVersionRepository) GetPolicy(userID uint) (*models.VersionPolicy, error) {
+	var p models.VersionPolicy
+	err := r.db.Where("user_id = ?", userID).First(&p).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &models.VersionPolicy{UserID: userID}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (r *fileVersionRepository) SavePolicy(p *models.VersionPolicy) error {
+	return r.db.Clauses(clause.OnConflict{UpdateAll: true}).Create(p).Error
+}
@@ -0,0 +1,93 @@
+package repositories
+
+import (
+	"time"
+
+	"file_project/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type FolderRepository interface {
+	Create(folder *models.Folder) error
+	FindByID(id uuid.UUID, ownerID uint) (*models.Folder, error)
+	ListByOwner(ownerID uint) ([]models.Folder, error)
+	CountChildren(id uuid.UUID) (int64, error)
+	Delete(id uuid.UUID, ownerID uint) error
+	SetRetention(id uuid.UUID, ownerID uint, days int) error
+	FindAny(id uuid.UUID) (*models.Folder, error)
+	SetHold(id uuid.UUID, legalHold bool, retainUntil *time.Time) error
+	ListHeld(now time.Time) ([]models.Folder, error)
+}
+
+type folderRepository struct {
+	db *gorm.DB
+}
+
+func NewFolderRepository(db *gorm.DB) FolderRepository {
+	return &folderRepository{db: db}
+}
+
+func (r *folderRepository) Create(folder *models.Folder) error {
+	return r.db.Create(folder).Error
+}
+
+func (r *folderRepository) FindByID(id uuid.UUID, ownerID uint) (*models.Folder, error) {
+	var f models.Folder
+	if err := r.db.Where("id = ? AND owner_id = ?", id, ownerID).First(&f).Error; err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+func (r *folderRepository) ListByOwner(ownerID uint) ([]models.Folder, error) {
+	var list []models.Folder
+	if err := r.db.Where("owner_id = ?", ownerID).Order("name").Find(&list).Error; err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// CountChildren counts sub-folders and files (including trashed ones) inside a folder
+func (r *folderRepository) CountChildren(id uuid.UUID) (int64, error) {
+	var folders, files int64
+	if err := r.db.Model(&models.Folder{}).Where("parent_id = ?", id).Count(&folders).Error; err != nil {
+		return 0, err
+	}
+	if err := r.db.Unscoped().Model(&models.EncryptedFile{}).Where("folder_id = ?", id).Count(&files).Error; err != nil {
+		return 0, err
+	}
+	return folders + files, nil
+}
+
+func (r *folderRepository) Delete(id uuid.UUID, ownerID uint) error {
+	return r.db.Where("id = ? AND owner_id = ?", id, ownerID).Delete(&models.Folder{}).Error
+}
+
+func (r *folderRepository) SetRetention(id uuid.UUID, ownerID uint, days int) error {
+	return r.db.Model(&models.Folder{}).Where("id = ? AND owner_id = ?", id, ownerID).Update("retention_days", days).Error
+}
+
+// FindAny finds a folder of any owner (for admin use)
+func (r *folderRepository) FindAny(id uuid.UUID) (*models.Folder, error) {
+	var f models.Folder
+	if err := r.db.Where("id = ?", id).First(&f).Error; err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+func (r *folderRepository) SetHold(id uuid.UUID, legalHold bool, retainUntil *time.Time) error {
+	return r.db.Model(&models.Folder{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"legal_hold": legalHold, "retain_until": retainUntil}).Error
+}
+
+// ListHeld returns folders of all users under a legal hold or an active retention lock
+func (r *folderRepository) ListHeld(now time.Time) ([]models.Folder, error) {
+	var list []models.Folder
+	if err := r.db.Where("legal_hold OR retain_until > ?", now).Order("owner_id, name").Find(&list).Error; err != nil {
+		return nil, err
+	}
+	return list, nil
+}
@@ -0,0 +1,60 @@
+package repositories
+
+import (
+	"errors"
+
+	"file_project/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type RetentionRepository interface {
+	GetPolicy(userID uint) (*models.RetentionPolicy, error)
+	SavePolicy(p *models.RetentionPolicy) error
+	ListActivePolicies() ([]models.RetentionPolicy, error)
+	ListRetentionFolders() ([]models.Folder, error)
+}
+
+type retentionRepository struct {
+	db *gorm.DB
+}
+
+func NewRetentionRepository(db *gorm.DB) RetentionRepository {
+	return &retentionRepository{db: db}
+}
+
+// GetPolicy returns the user's retention policy, or an empty (keep forever) policy if none is set
+func (r *retentionRepository) GetPolicy(userID uint) (*models.RetentionPolicy, error) {
+	var p models.RetentionPolicy
+	err := r.db.Where("user_id = ?", userID).First(&p).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &models.RetentionPolicy{UserID: userID}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (r *retentionRepository) SavePolicy(p *models.RetentionPolicy) error {
+	return r.db.Clauses(clause.OnConflict{UpdateAll: true}).Create(p).Error
+}
+
+// ListActivePolicies returns the policies of all users that expire files
+func (r *retentionRepository) ListActivePolicies() ([]models.RetentionPolicy, error) {
+	var list []models.RetentionPolicy
+	if err := r.db.Where("delete_after_days > 0").Find(&list).Error; err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// ListRetentionFolders returns the folders of all users that have a retention rule
+func (r *retentionRepository) ListRetentionFolders() ([]models.Folder, error) {
+	var list []models.Folder
+	if err := r.db.Where("retention_days > 0").Find(&list).Error; err != nil {
+		return nil, err
+	}
+	return list, nil
+}
@@ -0,0 +1,109 @@
+package repositories
+
+import (
+	"time"
+
+	"file_project/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type ShareAccessRepository interface {
+	Create(a *models.ShareAccess) error
+	ListByLink(linkID uuid.UUID, limit int) ([]models.ShareAccess, error)
+	StatsByLink(linkID uuid.UUID) (*models.ShareAccessStats, error)
+	StatsByFile(fileID uuid.UUID) (*models.ShareAccessStats, error)
+	DeleteBefore(t time.Time) (int64, error)
+}
+
+type shareAccessRepository struct {
+	db *gorm.DB
+}
+
+func NewShareAccessRepository(db *gorm.DB) ShareAccessRepository {
+	return &shareAccessRepository{db: db}
+}
+
+func (r *shareAccessRepository) Create(a *models.ShareAccess) error {
+	return r.db.Create(a).Error
+}
+
+// ListByLink returns a link's most recent accesses, newest first
+func (r *shareAccessRepository) ListByLink(linkID uuid.UUID, limit int) ([]models.ShareAccess, error) {
+	var list []models.ShareAccess
+	if err := r.db.Where("link_id = ?", linkID).Order("started_at DESC").Limit(limit).Find(&list).Error; err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (r *shareAccessRepository) StatsByLink(linkID uuid.UUID) (*models.ShareAccessStats, error) {
+	return r.stats("link_id = ?", linkID)
+}
+
+func (r *shareAccessRepository) StatsByFile(fileID uuid.UUID) (*models.ShareAccessStats, error) {
+	return r.stats("file_id = ?", fileID)
+}
+
+func (r *shareAccessRepository) stats(where string, id uuid.UUID) (*models.ShareAccessStats, error) {
+	var row struct {
+		Attempts      int64
+		Completed     int64
+		Incomplete    int64
+		Denied        int64
+		Failed        int64
+		BytesSent     int64
+		UniqueIPs     int64
+		AvgDurationMs float64
+		FirstAccess   *time.Time
+		LastAccess    *time.Time
+	}
+	err := r.db.Model(&models.ShareAccess{}).
+		Select(`COUNT(*) AS attempts,
+			COUNT(*) FILTER (WHERE outcome = ?) AS completed,
+			COUNT(*) FILTER (WHERE outcome = ?) AS incomplete,
+			COUNT(*) FILTER (WHERE outcome = ?) AS denied,
+			COUNT(*) FILTER (WHERE outcome = ?) AS failed,
+			COALESCE(SUM(bytes_sent), 0) AS bytes_sent,
+			COUNT(DISTINCT ip) AS unique_ips,
+			COALESCE(AVG(duration_ms) FILTER (WHERE outcome = ?), 0) AS avg_duration_ms,
+			MIN(started_at) AS first_access,
+			MAX(started_at) AS last_access`,
+			models.AccessCompleted, models.AccessIncomplete, models.AccessDenied, models.AccessFailed, models.AccessCompleted).
+		Where(where, id).Scan(&row).Error
+	if err != nil {
+		return nil, err
+	}
+	var reasons []struct {
+		Reason string
+		N      int64
+	}
+	if err := r.db.Model(&models.ShareAccess{}).Select("reason, COUNT(*) AS n").
+		Where(where, id).Where("outcome = ?", models.AccessDenied).Group("reason").Scan(&reasons).Error; err != nil {
+		return nil, err
+	}
+	s := &models.ShareAccessStats{
+		Attempts:       row.Attempts,
+		Completed:      row.Completed,
+		Incomplete:     row.Incomplete,
+		Denied:         row.Denied,
+		Failed:         row.Failed,
+		DeniedByReason: map[string]int64{},
+		BytesSent:      row.BytesSent,
+		UniqueIPs:      row.UniqueIPs,
+		AvgDurationMs:  int64(row.AvgDurationMs),
+		FirstAccess:    row.FirstAccess,
+		LastAccess:     row.LastAccess,
+	}
+	for _, r := range reasons {
+		s.DeniedByReason[r.Reason] = r.N
+	}
+	return s, nil
+}
+
+// DeleteBefore removes accesses older than t and returns how many there were
+func (r *shareAccessRepository) DeleteBefore(t time.Time) (int64, error) {
+	res := r.db.Where("started_at < ?", t).Delete(&models.ShareAccess{})
+	return res.RowsAffected, res.Error
+}
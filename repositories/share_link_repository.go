@@ -1,16 +1,26 @@
 package repositories
 
 import (
+	"time"
+
 	"file_project/models"
 
+	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type ShareLinkRepository interface {
 	Create(link *models.ShareLink) error
-	FindByToken(token string) (*models.ShareLink, error)
-	IncrementDownload(token string) error
-	Delete(token string, createdBy uint) error
+	FindByTokenHash(hash string) (*models.ShareLink, error)
+	FindByID(id uuid.UUID) (*models.ShareLink, error)
+	Claim(id uuid.UUID, now time.Time) (*models.ShareLink, error)
+	Unclaim(id uuid.UUID) error
+	Delete(id uuid.UUID, createdBy uint) error
+	ListByCreator(createdBy uint) ([]models.ShareLink, error)
+	ListByFile(fileID uuid.UUID, createdBy uint) ([]models.ShareLink, error)
+	Update(link *models.ShareLink) error
+	DeleteByFile(fileID uuid.UUID, createdBy uint) (int64, error)
 }
 
 type shareLinkRepository struct {
@@ -25,18 +35,80 @@ func (r *shareLinkRepository) Create(link *models.ShareLink) error {
 	return r.db.Create(link).Error
 }
 
-func (r *shareLinkRepository) FindByToken(token string) (*models.ShareLink, error) {
+func (r *shareLinkRepository) FindByTokenHash(hash string) (*models.ShareLink, error) {
+	var l models.ShareLink
+	if err := r.db.Preload("File").Preload("Folder").Where("token_hash = ?", hash).First(&l).Error; err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+func (r *shareLinkRepository) FindByID(id uuid.UUID) (*models.ShareLink, error) {
 	var l models.ShareLink
-	if err := r.db.Preload("File").Where("token = ?", token).First(&l).Error; err != nil {
+	if err := r.db.Preload("File").Preload("Folder").Where("id = ?", id).First(&l).Error; err != nil {
 		return nil, err
 	}
 	return &l, nil
 }
 
-func (r *shareLinkRepository) IncrementDownload(token string) error {
-	return r.db.Model(&models.ShareLink{}).Where("token = ?", token).UpdateColumn("downloads", gorm.Expr("downloads + 1")).Error
+// Claim counts one download in a single conditional UPDATE, so concurrent requests can never
+// exceed max_downloads. It returns nil when the link is disabled, expired or used up.
+func (r *shareLinkRepository) Claim(id uuid.UUID, now time.Time) (*models.ShareLink, error) {
+	var l models.ShareLink
+	res := r.db.Model(&l).Clauses(clause.Returning{}).
+		Where("id = ? AND NOT disabled", id).
+		Where("expires_at IS NULL OR expires_at > ?", now).
+		Where("max_downloads IS NULL OR downloads < max_downloads").
+		UpdateColumn("downloads", gorm.Expr("downloads + 1"))
+	if res.Error != nil || res.RowsAffected == 0 {
+		return nil, res.Error
+	}
+	return &l, nil
+}
+
+// Unclaim gives back a download that was claimed but not completed
+func (r *shareLinkRepository) Unclaim(id uuid.UUID) error {
+	return r.db.Model(&models.ShareLink{}).Where("id = ? AND downloads > 0", id).UpdateColumn("downloads", gorm.Expr("downloads - 1")).Error
+}
+
+func (r *shareLinkRepository) Delete(id uuid.UUID, createdBy uint) error {
+	res := r.db.Where("id = ? AND created_by_user = ?", id, createdBy).Delete(&models.ShareLink{})
+	if res.Error == nil && res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return res.Error
+}
+
+// ListByCreator returns the links a user created, newest first, with their files preloaded
+func (r *shareLinkRepository) ListByCreator(createdBy uint) ([]models.ShareLink, error) {
+	var list []models.ShareLink
+	if err := r.db.Preload("File").Preload("Folder").Where("created_by_user = ?", createdBy).Order("created_at DESC").Find(&list).Error; err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (r *shareLinkRepository) ListByFile(fileID uuid.UUID, createdBy uint) ([]models.ShareLink, error) {
+	var list []models.ShareLink
+	if err := r.db.Preload("File").Where("file_id = ? AND created_by_user = ?", fileID, createdBy).Order("created_at DESC").Find(&list).Error; err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// editableLinkFields are the columns Update writes. Counters such as downloads are changed only by their
+// own atomic statements, so a concurrent download is never overwritten by an edit.
+var editableLinkFields = []string{
+	"ExpiresAt", "MaxDownloads", "Disabled", "HideFilename",
+	"AllowedCIDRs", "NotBefore", "AllowedWeekdays", "HoursFrom", "HoursTo", "TimeZone", "AllowedOrigins",
+}
+
+// Update saves the editable settings of a link; usage counters and the preloaded file are left untouched
+func (r *shareLinkRepository) Update(link *models.ShareLink) error {
+	return r.db.Model(link).Select(editableLinkFields).Updates(link).Error
 }
 
-func (r *shareLinkRepository) Delete(token string, createdBy uint) error {
-	return r.db.Where("token = ? AND created_by_user = ?", token, createdBy).Delete(&models.ShareLink{}).Error
+func (r *shareLinkRepository) DeleteByFile(fileID uuid.UUID, createdBy uint) (int64, error) {
+	res := r.db.Where("file_id = ? AND created_by_user = ?", fileID, createdBy).Delete(&models.ShareLink{})
+	return res.RowsAffected, res.Error
 }
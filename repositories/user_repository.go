@@ -10,6 +10,7 @@ type UserRepository interface {
 	Create(user *models.User) error
 	FindByEmail(email string) (*models.User, error)
 	CountByEmail(email string) (int64, error)
+	FindByID(id uint) (*models.User, error)
 }
 
 type userRepository struct {
@@ -37,3 +38,11 @@ func (r *userRepository) CountByEmail(email string) (int64, error) {
 	r.db.Model(&models.User{}).Where("email = ?", email).Count(&count)
 	return count, nil
 }
+
+func (r *userRepository) FindByID(id uint) (*models.User, error) {
+	var user models.User
+	if err := r.db.Where("id = ?", id).First(&user).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
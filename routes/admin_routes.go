@@ -0,0 +1,24 @@
+package routes
+
+import (
+	"file_project/controllers"
+	"file_project/middleware"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/expvar"
+)
+
+// Admin routes (JWT + admin role)
+func AdminRoutes(app *fiber.App, ac *controllers.AdminController, hc *controllers.HoldController) {
+	g := app.Group("/api/admin", middleware.JWTProtected, middleware.AdminOnly)
+	g.Get("/integrity", ac.Integrity)
+	g.Post("/integrity/scrub", ac.Scrub)
+
+	// Legal holds (also require the hold privilege)
+	g.Get("/holds", hc.List)
+	g.Put("/holds/files/:id", hc.SetFileHold)
+	g.Put("/holds/folders/:id", hc.SetFolderHold)
+
+	// expvar metrics
+	app.Get("/debug/vars", middleware.JWTProtected, middleware.AdminOnly, expvar.New())
+}
@@ -0,0 +1,13 @@
+package routes
+
+import (
+	"file_project/controllers"
+	"file_project/middleware"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func AuditRoutes(app *fiber.App, ac *controllers.AuditController) {
+	g := app.Group("/api/audit", middleware.JWTProtected)
+	g.Get("/", ac.List)
+}
@@ -0,0 +1,22 @@
+package routes
+
+import (
+	"file_project/controllers"
+	"file_project/middleware"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// FileRequestRoutes registers upload-only links
+func FileRequestRoutes(app *fiber.App, fc *controllers.FileRequestController) {
+	// Owner manages requests (protected)
+	g := app.Group("/api/file-requests", middleware.JWTProtected)
+	g.Post("/", fc.Create)
+	g.Get("/", fc.List)
+	g.Patch("/:id", fc.Update)
+	g.Delete("/:id", fc.Delete)
+
+	// Public upload (no JWT)
+	app.Get("/request/:token", fc.PublicInfo)
+	app.Post("/request/:token/upload", fc.PublicUpload)
+}
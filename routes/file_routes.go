@@ -1,17 +1,60 @@
 package routes
 
 import (
+	"fmt"
+	"time"
+
+	"file_project/config"
 	"file_project/controllers"
 	"file_project/middleware"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/limiter"
 )
 
 func FileRoutes(app *fiber.App, fc *controllers.FileController) {
 	g := app.Group("/api/files", middleware.JWTProtected)
 	g.Post("/upload", fc.Upload)
 	g.Get("/:id/download", fc.Download) // password in query param ?password=...
+	g.Get("/:id/preview", fc.Preview)   // password in query param ?password=...
 	g.Patch("/:id/password", fc.ChangePassword)
 	g.Delete("/:id", fc.Delete)
 	g.Get("/", fc.List)
+	g.Get("/policy", fc.Policy)
+	g.Get("/dedup", fc.GetDedup)
+	g.Put("/dedup", fc.SetDedup)
+	g.Put("/:id/expiry", fc.SetExpiry)
+	g.Patch("/:id", fc.Rename)
+	g.Get("/:id/metadata", fc.GetMetadata)
+	g.Put("/:id/metadata", fc.SetMetadata)
+
+	// Check-out locks
+	g.Get("/:id/lock", fc.GetLock)
+	g.Post("/:id/lock", fc.Lock)
+	g.Delete("/:id/lock", fc.Unlock) // ?force=true breaks another user's lock (admin only)
+
+	// Retention
+	g.Get("/retention-policy", fc.GetRetentionPolicy)
+	g.Put("/retention-policy", fc.SetRetentionPolicy)
+
+	// Bulk operations, rate limited per user
+	g.Post("/batch", limiter.New(limiter.Config{
+		Max:        config.C.BatchRatePerMinute,
+		Expiration: time.Minute,
+		KeyGenerator: func(c *fiber.Ctx) string {
+			return fmt.Sprint(c.Locals("user_id"))
+		},
+		LimitReached: func(c *fiber.Ctx) error {
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{"error": "too many batch requests"})
+		},
+	}), fc.Batch)
+	g.Post("/archive", fc.Archive)
+
+	// Versioning
+	g.Get("/version-policy", fc.GetVersionPolicy)
+	g.Put("/version-policy", fc.SetVersionPolicy)
+	g.Post("/:id/versions", fc.UploadVersion)
+	g.Get("/:id/versions", fc.ListVersions)
+	g.Get("/:id/versions/:version/download", fc.DownloadVersion) // password in query param ?password=...
+	g.Post("/:id/versions/:version/restore", fc.RestoreVersion)
 }
@@ -0,0 +1,16 @@
+package routes
+
+import (
+	"file_project/controllers"
+	"file_project/middleware"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func FolderRoutes(app *fiber.App, fc *controllers.FolderController) {
+	g := app.Group("/api/folders", middleware.JWTProtected)
+	g.Post("/", fc.Create)
+	g.Get("/", fc.List)
+	g.Delete("/:id", fc.Delete)
+	g.Put("/:id/retention", fc.SetRetention)
+}
@@ -0,0 +1,21 @@
+package routes
+
+import (
+	"file_project/controllers"
+	"file_project/middleware"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GrantRoutes registers shares with named users
+func GrantRoutes(app *fiber.App, gc *controllers.GrantController) {
+	app.Get("/api/files/:id/grants", middleware.JWTProtected, gc.List)
+	app.Post("/api/files/:id/grants", middleware.JWTProtected, gc.Grant)
+	app.Delete("/api/files/:id/grants/:shareId", middleware.JWTProtected, gc.Revoke)
+
+	g := app.Group("/api/shared-with-me", middleware.JWTProtected)
+	g.Get("/", gc.SharedWithMe)
+	g.Post("/claim", gc.Claim)
+	g.Get("/:id/download", gc.Download)  // password in query param ?password=...
+	g.Post("/:id/download", gc.Download) // password in the body, kept out of URLs and logs
+}
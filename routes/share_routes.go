@@ -12,8 +12,26 @@ func ShareRoutes(app *fiber.App, sc *controllers.ShareController) {
 	// Owner creates/deletes share links (protected)
 	g := app.Group("/api/share", middleware.JWTProtected)
 	g.Post("/", sc.Create)
-	g.Delete("/:token", sc.Delete)
+	g.Get("/", sc.List)
+	g.Patch("/:id", sc.Update)
+	g.Delete("/:id", sc.Delete)
+	g.Get("/:id/accesses", sc.Accesses)
+	g.Get("/:id/stats", sc.Stats)
 
-	// Public download (no JWT), but still needs password
+	// Links of one file
+	app.Get("/api/files/:id/shares", middleware.JWTProtected, sc.ListForFile)
+	app.Delete("/api/files/:id/shares", middleware.JWTProtected, sc.RevokeAll)
+	app.Get("/api/files/:id/shares/stats", middleware.JWTProtected, sc.FileStats)
+
+	// Public metadata and download (no JWT); downloads still need the password, preferably in a POST body
+	app.Get("/share/:token", sc.PublicInfo)
 	app.Get("/share/:token/download", sc.PublicDownload)
+	app.Post("/share/:token/download", sc.PublicDownload)
+
+	// Public folder links: browse, then download one file or the whole folder
+	app.Get("/share/:token/list", sc.PublicList)
+	app.Get("/share/:token/files/:fileId/download", sc.PublicFileDownload)
+	app.Post("/share/:token/files/:fileId/download", sc.PublicFileDownload)
+	app.Get("/share/:token/archive", sc.PublicArchive)
+	app.Post("/share/:token/archive", sc.PublicArchive)
 }
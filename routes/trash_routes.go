@@ -0,0 +1,16 @@
+package routes
+
+import (
+	"file_project/controllers"
+	"file_project/middleware"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TrashRoutes(app *fiber.App, tc *controllers.TrashController) {
+	g := app.Group("/api/trash", middleware.JWTProtected)
+	g.Get("/", tc.List)
+	g.Post("/:id/restore", tc.Restore)
+	g.Delete("/:id", tc.Delete)
+	g.Delete("/", tc.Empty)
+}
@@ -0,0 +1,224 @@
+package services
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"file_project/models"
+
+	"github.com/google/uuid"
+)
+
+// Supported archive formats
+const (
+	ArchiveZip   = "zip"
+	ArchiveTarGz = "tar.gz"
+)
+
+// ArchiveEntry is one file to be written into an archive under Name.
+// Entries with Data instead of a File (such as the metadata manifest) are written as is.
+type ArchiveEntry struct {
+	File *models.EncryptedFile
+	Name string
+	Data []byte
+}
+
+// ArchivePasswordError lists the files whose password was missing or wrong
+type ArchivePasswordError struct {
+	FileIDs []uuid.UUID
+}
+
+func (e *ArchivePasswordError) Error() string {
+	return fmt.Sprintf("invalid password for %d file(s)", len(e.FileIDs))
+}
+
+// ResolveArchive expands the requested files and folders (recursively) of owner into archive entries.
+// Files inside folders are placed under their folder path; duplicate names get a numeric suffix.
+func (s *FileService) ResolveArchive(ownerID uint, fileIDs, folderIDs []uuid.UUID) ([]ArchiveEntry, error) {
+	var entries []ArchiveEntry
+	seen := map[uuid.UUID]bool{}
+	names := map[string]int{}
+	add := func(f models.EncryptedFile, dir string) {
+		// quarantined files are left out of archives
+		if seen[f.ID] || f.ScanStatus == models.ScanInfected {
+			return
+		}
+		seen[f.ID] = true
+		file := f
+		entries = append(entries, ArchiveEntry{File: &file, Name: uniqueName(names, path.Join(dir, safeEntryName(f.Filename)))})
+	}
+
+	for _, id := range fileIDs {
+		f, err := s.Files.FindByID(id, ownerID)
+		if err != nil {
+			return nil, err
+		}
+		add(*f, "")
+	}
+
+	if len(folderIDs) > 0 {
+		folders, err := s.Folders.ListByOwner(ownerID)
+		if err != nil {
+			return nil, err
+		}
+		children := map[uuid.UUID][]models.Folder{}
+		byID := map[uuid.UUID]models.Folder{}
+		for _, f := range folders {
+			byID[f.ID] = f
+			if f.ParentID != nil {
+				children[*f.ParentID] = append(children[*f.ParentID], f)
+			}
+		}
+		var walk func(folder models.Folder, dir string, depth int) error
+		walk = func(folder models.Folder, dir string, depth int) error {
+			if depth > 64 {
+				return errors.New("folder nesting too deep")
+			}
+			dir = path.Join(dir, safeEntryName(folder.Name))
+			files, err := s.Files.ListByFolder(ownerID, folder.ID)
+			if err != nil {
+				return err
+			}
+			for _, f := range files {
+				add(f, dir)
+			}
+			for _, child := range children[folder.ID] {
+				if err := walk(child, dir, depth+1); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		for _, id := range folderIDs {
+			folder, ok := byID[id]
+			if !ok {
+				return nil, fmt.Errorf("folder %s not found", id)
+			}
+			if err := walk(folder, "", 0); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return entries, nil
+}
+
+// VerifyArchivePasswords checks every entry's password up front so a bad password is reported
+// before any part of the archive is sent.
+func (s *FileService) VerifyArchivePasswords(entries []ArchiveEntry, passwordFor func(*models.EncryptedFile) string) error {
+	var bad []uuid.UUID
+	for _, e := range entries {
+		if e.File == nil {
+			continue
+		}
+		pwd := passwordFor(e.File)
+		if pwd == "" {
+			bad = append(bad, e.File.ID)
+			continue
+		}
+		r, err := s.openBlob(e.File.Path, pwd)
+		if err != nil {
+			bad = append(bad, e.File.ID)
+			continue
+		}
+		r.Close()
+	}
+	if len(bad) > 0 {
+		return &ArchivePasswordError{FileIDs: bad}
+	}
+	return nil
+}
+
+// WriteArchive streams entries into w as a zip or tar.gz archive, decrypting each file on the fly.
+// Stream-format blobs never hold more than one chunk of plaintext in memory; legacy blobs are
+// decrypted one entry at a time.
+func (s *FileService) WriteArchive(w io.Writer, format string, entries []ArchiveEntry, passwordFor func(*models.EncryptedFile) string) error {
+	switch format {
+	case ArchiveZip:
+		zw := zip.NewWriter(w)
+		for _, e := range entries {
+			hw, err := zw.CreateHeader(&zip.FileHeader{Name: e.Name, Method: zip.Deflate, Modified: entryModTime(e)})
+			if err != nil {
+				return err
+			}
+			if err := s.copyEntry(hw, e, passwordFor); err != nil {
+				return err
+			}
+		}
+		return zw.Close()
+	case ArchiveTarGz:
+		gz := gzip.NewWriter(w)
+		tw := tar.NewWriter(gz)
+		for _, e := range entries {
+			size := int64(len(e.Data))
+			if e.File != nil {
+				var err error
+				if size, err = PlaintextSize(e.File.Path); err != nil {
+					return err
+				}
+			}
+			if err := tw.WriteHeader(&tar.Header{Name: e.Name, Mode: 0600, Size: size, ModTime: entryModTime(e), Typeflag: tar.TypeReg}); err != nil {
+				return err
+			}
+			if err := s.copyEntry(tw, e, passwordFor); err != nil {
+				return err
+			}
+		}
+		if err := tw.Close(); err != nil {
+			return err
+		}
+		return gz.Close()
+	default:
+		return fmt.Errorf("unsupported archive format %q", format)
+	}
+}
+
+func (s *FileService) copyEntry(w io.Writer, e ArchiveEntry, passwordFor func(*models.EncryptedFile) string) error {
+	if e.File == nil {
+		_, err := w.Write(e.Data)
+		return err
+	}
+	r, err := s.openBlob(e.File.Path, passwordFor(e.File))
+	if err != nil {
+		return fmt.Errorf("%s: %w", e.Name, err)
+	}
+	defer r.Close()
+	_, err = io.Copy(w, r)
+	return err
+}
+
+func entryModTime(e ArchiveEntry) time.Time {
+	if e.File == nil || e.File.UpdatedAt.IsZero() {
+		return time.Now()
+	}
+	return e.File.UpdatedAt
+}
+
+// safeEntryName strips path separators so names cannot escape their folder inside the archive
+func safeEntryName(name string) string {
+	name = strings.NewReplacer("/", "_", "\\", "_").Replace(name)
+	if name == "" || name == "." || name == ".." {
+		return "_"
+	}
+	return name
+}
+
+// uniqueName appends " (n)" before the extension when name was already used
+func uniqueName(used map[string]int, name string) string {
+	candidate := name
+	ext := path.Ext(name)
+	for n := used[name]; used[candidate] > 0; n++ {
+		candidate = fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), n, ext)
+	}
+	if candidate != name {
+		used[name]++
+	}
+	used[candidate]++
+	return candidate
+}
@@ -0,0 +1,164 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	"file_project/models"
+	"file_project/repositories"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Batch operation names
+const (
+	BatchOpDelete = "delete"
+	BatchOpMove   = "move"
+	BatchOpTag    = "tag"
+	BatchOpUntag  = "untag"
+	BatchOpShare  = "share"
+)
+
+// Per-item result states
+const (
+	BatchStatusOK         = "ok"
+	BatchStatusFailed     = "failed"
+	BatchStatusRolledBack = "rolled_back"
+	BatchStatusSkipped    = "skipped"
+)
+
+var errBatchAborted = errors.New("batch aborted")
+
+// BatchOperation is a single item of a batch request
+type BatchOperation struct {
+	Op               string   `json:"op"`
+	FileID           string   `json:"file_id"`
+	FolderID         *string  `json:"folder_id,omitempty"` // move: target folder, null for top level
+	Tags             []string `json:"tags,omitempty"`      // tag/untag
+	ExpiresInMinutes *int     `json:"expires_in_minutes,omitempty"`
+	MaxDownloads     *int     `json:"max_downloads,omitempty"`
+}
+
+// BatchResult reports the outcome of one operation
+type BatchResult struct {
+	Index  int               `json:"index"`
+	Op     string            `json:"op"`
+	FileID string            `json:"file_id"`
+	Status string            `json:"status"`
+	Error  string            `json:"error,omitempty"`
+	Share  *models.ShareLink `json:"share,omitempty"`
+}
+
+// BatchService applies many file operations in a single request.
+// In atomic mode every operation runs inside one database transaction; since deletes only move
+// files to the trash, no blob on disk is touched and a rollback fully undoes the batch.
+type BatchService struct {
+	DB *gorm.DB
+}
+
+func NewBatchService(db *gorm.DB) *BatchService {
+	return &BatchService{DB: db}
+}
+
+// Run executes ops for owner and reports whether the batch was committed
+func (s *BatchService) Run(ownerID uint, ops []BatchOperation, atomic bool) ([]BatchResult, bool) {
+	results := make([]BatchResult, len(ops))
+	for i, op := range ops {
+		results[i] = BatchResult{Index: i, Op: op.Op, FileID: op.FileID, Status: BatchStatusSkipped}
+	}
+
+	if !atomic {
+		files, shares := scopedServices(s.DB)
+		for i := range ops {
+			applyBatchOp(files, shares, ownerID, ops[i], &results[i])
+		}
+		return results, true
+	}
+
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		files, shares := scopedServices(tx)
+		for i := range ops {
+			if !applyBatchOp(files, shares, ownerID, ops[i], &results[i]) {
+				return errBatchAborted
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		for i := range results {
+			if results[i].Status == BatchStatusOK {
+				results[i].Status = BatchStatusRolledBack
+				results[i].Share = nil
+			}
+		}
+		if !errors.Is(err, errBatchAborted) {
+			// commit itself failed: report it on every item that had succeeded
+			for i := range results {
+				if results[i].Status == BatchStatusRolledBack {
+					results[i].Error = err.Error()
+				}
+			}
+		}
+		return results, false
+	}
+	return results, true
+}
+
+// scopedServices builds file and share services bound to db (either the pool or a transaction)
+func scopedServices(db *gorm.DB) (*FileService, *ShareLinkService) {
+	files := NewFileService(repositories.NewFileRepository(db), repositories.NewFileVersionRepository(db), repositories.NewFolderRepository(db), repositories.NewFilePreviewRepository(db), repositories.NewBlobRepository(db), repositories.NewDataKeyRepository(db))
+	shares := NewShareLinkService(repositories.NewShareLinkRepository(db), repositories.NewShareAccessRepository(db))
+	return files, shares
+}
+
+// applyBatchOp runs one operation and fills in res; it returns false when the operation failed
+func applyBatchOp(files *FileService, shares *ShareLinkService, ownerID uint, op BatchOperation, res *BatchResult) bool {
+	err := func() error {
+		id, err := uuid.Parse(op.FileID)
+		if err != nil {
+			return errors.New("invalid file_id")
+		}
+		switch op.Op {
+		case BatchOpDelete:
+			return files.Delete(ownerID, id)
+		case BatchOpMove:
+			var folderID *uuid.UUID
+			if op.FolderID != nil {
+				fid, err := uuid.Parse(*op.FolderID)
+				if err != nil {
+					return errors.New("invalid folder_id")
+				}
+				folderID = &fid
+			}
+			return files.Move(ownerID, id, folderID)
+		case BatchOpTag:
+			return files.AddTags(ownerID, id, op.Tags)
+		case BatchOpUntag:
+			return files.RemoveTags(ownerID, id, op.Tags)
+		case BatchOpShare:
+			if _, err := files.Shareable(ownerID, id); err != nil {
+				return err
+			}
+			link, err := shares.CreateShareLink(id, ownerID, op.ExpiresInMinutes, op.MaxDownloads, nil, nil, models.ShareRestrictions{}, false)
+			if err != nil {
+				return err
+			}
+			res.Share = link
+			return nil
+		default:
+			return fmt.Errorf("unknown op %q", op.Op)
+		}
+	}()
+	if err != nil {
+		res.Status = BatchStatusFailed
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			res.Error = "not found"
+		} else {
+			res.Error = err.Error()
+		}
+		return false
+	}
+	res.Status = BatchStatusOK
+	return true
+}
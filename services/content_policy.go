@@ -0,0 +1,163 @@
+package services
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Machine-readable reasons for a rejected upload
+const (
+	PolicyExtensionBlocked    = "extension_blocked"
+	PolicyExtensionNotAllowed = "extension_not_allowed"
+	PolicyMimeBlocked         = "mime_type_blocked"
+	PolicyMimeNotAllowed      = "mime_type_not_allowed"
+	PolicyMagicBlocked        = "magic_bytes_blocked"
+	PolicyTooLarge            = "file_too_large"
+)
+
+// ContentPolicy decides which files may be stored. It is loaded from the JSON file named by
+// CONTENT_POLICY_FILE. Deny lists always win; a non-empty allow list admits only what it names.
+// MIME entries and MaxSizes keys accept a "type/*" wildcard, and MaxSizes may use "*" as a default.
+type ContentPolicy struct {
+	AllowedExtensions []string         `json:"allowed_extensions"`
+	BlockedExtensions []string         `json:"blocked_extensions"`
+	AllowedMimeTypes  []string         `json:"allowed_mime_types"`
+	BlockedMimeTypes  []string         `json:"blocked_mime_types"`
+	BlockedMagic      []string         `json:"blocked_magic_bytes"` // hex prefixes, e.g. "4d5a" for Windows executables
+	MaxSizes          map[string]int64 `json:"max_sizes"`           // MIME pattern -> max plaintext bytes
+
+	magic [][]byte
+}
+
+// PolicyViolation is returned when an upload breaks the content policy
+type PolicyViolation struct {
+	Code    string
+	Message string
+}
+
+func (e *PolicyViolation) Error() string {
+	return e.Message
+}
+
+// LoadContentPolicy reads and validates a policy file
+func LoadContentPolicy(path string) (*ContentPolicy, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var p ContentPolicy
+	if err := json.Unmarshal(raw, &p); err != nil {
+		return nil, fmt.Errorf("content policy: %w", err)
+	}
+	for _, h := range p.BlockedMagic {
+		b, err := hex.DecodeString(strings.ReplaceAll(h, " ", ""))
+		if err != nil || len(b) == 0 {
+			return nil, fmt.Errorf("content policy: invalid magic bytes %q", h)
+		}
+		p.magic = append(p.magic, b)
+	}
+	return &p, nil
+}
+
+// Check validates a file's name, sniffed MIME type, leading bytes and plaintext size against the policy
+func (p *ContentPolicy) Check(filename, mimeType string, head []byte, size int64) error {
+	ext := strings.ToLower(filepath.Ext(filename))
+	if hasExtension(p.BlockedExtensions, ext) {
+		return &PolicyViolation{Code: PolicyExtensionBlocked, Message: fmt.Sprintf("files with extension %q are not allowed", ext)}
+	}
+	if len(p.AllowedExtensions) > 0 && !hasExtension(p.AllowedExtensions, ext) {
+		return &PolicyViolation{Code: PolicyExtensionNotAllowed, Message: fmt.Sprintf("extension %q is not on the allow list", ext)}
+	}
+	base, _, _ := mime.ParseMediaType(mimeType)
+	if matchAnyMime(p.BlockedMimeTypes, base) {
+		return &PolicyViolation{Code: PolicyMimeBlocked, Message: fmt.Sprintf("content type %s is not allowed", base)}
+	}
+	if len(p.AllowedMimeTypes) > 0 && !matchAnyMime(p.AllowedMimeTypes, base) {
+		return &PolicyViolation{Code: PolicyMimeNotAllowed, Message: fmt.Sprintf("content type %s is not on the allow list", base)}
+	}
+	for _, m := range p.magic {
+		if bytes.HasPrefix(head, m) {
+			return &PolicyViolation{Code: PolicyMagicBlocked, Message: "file signature is not allowed"}
+		}
+	}
+	if limit, ok := p.maxSizeFor(base); ok && size > limit {
+		return &PolicyViolation{Code: PolicyTooLarge, Message: fmt.Sprintf("%s files are limited to %d bytes", base, limit)}
+	}
+	return nil
+}
+
+// maxSizeFor picks the most specific size limit: exact type, then "type/*", then "*"
+func (p *ContentPolicy) maxSizeFor(base string) (int64, bool) {
+	if v, ok := p.MaxSizes[base]; ok {
+		return v, true
+	}
+	if i := strings.Index(base, "/"); i > 0 {
+		if v, ok := p.MaxSizes[base[:i]+"/*"]; ok {
+			return v, true
+		}
+	}
+	v, ok := p.MaxSizes["*"]
+	return v, ok
+}
+
+// Summary lists the active rules, for clients that want to validate before uploading
+func (p *ContentPolicy) Summary() map[string]interface{} {
+	return map[string]interface{}{
+		"allowed_extensions": p.AllowedExtensions,
+		"blocked_extensions": p.BlockedExtensions,
+		"allowed_mime_types": p.AllowedMimeTypes,
+		"blocked_mime_types": p.BlockedMimeTypes,
+		"max_sizes":          p.MaxSizes,
+	}
+}
+
+// checkPolicy sniffs an upload and validates it against the configured policy, if any
+func (s *FileService) checkPolicy(header *multipart.FileHeader) error {
+	if s.Policy == nil {
+		return nil
+	}
+	src, err := header.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(src, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return err
+	}
+	head = head[:n]
+	return s.Policy.Check(header.Filename, DetectMimeType(head, header.Filename), head, header.Size)
+}
+
+// hasExtension reports whether ext is in list; entries may be given with or without the leading dot
+func hasExtension(list []string, v string) bool {
+	for _, item := range list {
+		item = strings.ToLower(item)
+		if !strings.HasPrefix(item, ".") {
+			item = "." + item
+		}
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
+
+func matchAnyMime(patterns []string, base string) bool {
+	for _, p := range patterns {
+		p = strings.ToLower(p)
+		if p == base || (strings.HasSuffix(p, "/*") && strings.HasPrefix(base, strings.TrimSuffix(p, "*"))) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+const sniffLen = 512
+
+// inlineSafeTypes may be served with Content-Disposition: inline. Anything that a browser could
+// execute (HTML, SVG, XML, JavaScript) is always sent as an attachment.
+var inlineSafeTypes = map[string]bool{
+	"image/png":        true,
+	"image/jpeg":       true,
+	"image/gif":        true,
+	"image/webp":       true,
+	"image/bmp":        true,
+	"application/pdf":  true,
+	"text/plain":       true,
+	"text/csv":         true,
+	"audio/mpeg":       true,
+	"audio/wave":       true,
+	"audio/ogg":        true,
+	"video/mp4":        true,
+	"video/webm":       true,
+	"application/json": true,
+}
+
+// plainInspector observes plaintext as it is encrypted: it hashes it, counts it and keeps the first bytes for sniffing
+type plainInspector struct {
+	r    io.Reader
+	h    hash.Hash
+	head []byte
+	n    int64
+}
+
+func newPlainInspector(r io.Reader) *plainInspector {
+	return &plainInspector{r: r, h: sha256.New(), head: make([]byte, 0, sniffLen)}
+}
+
+func (p *plainInspector) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if n > 0 {
+		p.h.Write(b[:n])
+		p.n += int64(n)
+		if room := sniffLen - len(p.head); room > 0 {
+			p.head = append(p.head, b[:min(n, room)]...)
+		}
+	}
+	return n, err
+}
+
+func (p *plainInspector) Sum() string {
+	return hex.EncodeToString(p.h.Sum(nil))
+}
+
+// DetectMimeType sniffs the content of a file and falls back to its extension when the content is not conclusive
+func DetectMimeType(head []byte, filename string) string {
+	sniffed := http.DetectContentType(head)
+	byExt := mime.TypeByExtension(strings.ToLower(filepath.Ext(filename)))
+	if byExt == "" {
+		return sniffed
+	}
+	base, _, _ := mime.ParseMediaType(sniffed)
+	switch base {
+	case "application/octet-stream":
+		// binary content the sniffer does not recognise
+		return byExt
+	case "text/plain":
+		// text may be refined to a more specific type, but never to one a browser would render
+		if IsInlineSafe(byExt) {
+			return byExt
+		}
+	}
+	return sniffed
+}
+
+// ContentTypeFor returns the stored MIME type, or a guess from the filename for files uploaded before detection existed
+func ContentTypeFor(mimeType, filename string) string {
+	if mimeType != "" {
+		return mimeType
+	}
+	if byExt := mime.TypeByExtension(strings.ToLower(filepath.Ext(filename))); byExt != "" && IsInlineSafe(byExt) {
+		return byExt
+	}
+	return "application/octet-stream"
+}
+
+// IsInlineSafe reports whether a MIME type can be displayed inline without risk of script execution
+func IsInlineSafe(mimeType string) bool {
+	base, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		return false
+	}
+	return inlineSafeTypes[base]
+}
@@ -0,0 +1,142 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"path/filepath"
+	"time"
+
+	"file_project/config"
+	"file_project/models"
+
+	"github.com/google/uuid"
+)
+
+// DedupStatus is a user's deduplication setting together with what it currently saves
+type DedupStatus struct {
+	Enabled     bool  `json:"enabled"`
+	SharedBlobs int64 `json:"shared_blobs"`
+	BytesSaved  int64 `json:"bytes_saved"`
+}
+
+// GetDedup returns the owner's deduplication setting and savings
+func (s *FileService) GetDedup(ownerID uint) (*DedupStatus, error) {
+	setting, err := s.Blobs.GetSetting(ownerID)
+	if err != nil {
+		return nil, err
+	}
+	shared, saved, err := s.Blobs.Stats(ownerID)
+	if err != nil {
+		return nil, err
+	}
+	return &DedupStatus{Enabled: setting.Enabled, SharedBlobs: shared, BytesSaved: saved}, nil
+}
+
+// SetDedup turns deduplication on or off for future uploads. Blobs that are already shared stay shared.
+func (s *FileService) SetDedup(ownerID uint, enabled bool) (*DedupStatus, error) {
+	if err := s.Blobs.SaveSetting(&models.DedupSetting{UserID: ownerID, Enabled: enabled}); err != nil {
+		return nil, err
+	}
+	return s.GetDedup(ownerID)
+}
+
+// storeBlob encrypts an upload as the given version. With deduplication enabled it first looks for
+// an identical blob of the same owner and links to it instead of writing a new copy.
+func (s *FileService) storeBlob(ownerID uint, fileID uuid.UUID, version int, filename string, header *multipart.FileHeader, src io.Reader, password string) (*models.FileVersion, error) {
+	setting, err := s.Blobs.GetSetting(ownerID)
+	if err != nil {
+		return nil, err
+	}
+	if !setting.Enabled {
+		return s.writeBlob(newBlobPath(), fileID, version, filename, src, password)
+	}
+	key, plain, err := dedupKey(ownerID, header)
+	if err != nil {
+		return nil, err
+	}
+	if b, err := s.Blobs.FindByKey(ownerID, key); err == nil && s.linkBlob(b, password) {
+		now := time.Now()
+		return &models.FileVersion{
+			FileID:       fileID,
+			Version:      version,
+			Path:         b.Path,
+			Size:         b.Size,
+			OriginalSize: plain.n,
+			MimeType:     DetectMimeType(plain.head, filename),
+			SHA256:       plain.Sum(),
+			BlobSHA256:   b.BlobSHA256,
+			Integrity:    models.IntegrityOK,
+			CheckedAt:    &now,
+		}, nil
+	}
+	v, err := s.writeBlob(newBlobPath(), fileID, version, filename, src, password)
+	if err != nil {
+		return nil, err
+	}
+	// a blob stored under another password keeps the key; this copy then simply stays unshared
+	if err := s.Blobs.Create(&models.Blob{OwnerID: ownerID, DedupKey: key, Path: v.Path, Size: v.Size, BlobSHA256: v.BlobSHA256, RefCount: 1}); err != nil {
+		log.Printf("dedup: blob for %s v%d not registered: %v", fileID, version, err)
+	}
+	return v, nil
+}
+
+// linkBlob takes a reference on an existing blob if it opens with password and is intact on disk.
+// Requiring the password keeps one file's key from being bound to another file's content.
+func (s *FileService) linkBlob(b *models.Blob, password string) bool {
+	r, err := s.openBlob(b.Path, password)
+	if err != nil {
+		return false
+	}
+	r.Close()
+	if sum, err := hashFile(b.Path); err != nil || sum != b.BlobSHA256 {
+		return false
+	}
+	ok, err := s.Blobs.AddRef(b.ID)
+	return err == nil && ok
+}
+
+// releaseBlob drops one reference to the blob at path and destroys it once nothing points at it.
+// Blobs that were never deduplicated have no reference count and are destroyed right away.
+// It returns the deletion guarantee that applied.
+func (s *FileService) releaseBlob(path string) string {
+	remaining, tracked, err := s.Blobs.Release(path)
+	if err != nil {
+		// keep the file rather than risk deleting data another version still uses
+		log.Printf("dedup: release of %s failed: %v", path, err)
+		return DeletionRetainedShared
+	}
+	if tracked && remaining > 0 {
+		return DeletionRetainedShared
+	}
+	return s.destroyBlob(path)
+}
+
+// dedupKey reads the whole upload once and returns an HMAC-SHA256 of its plaintext under a key
+// derived for the owner, so equal files of different users never produce the same value.
+func dedupKey(ownerID uint, header *multipart.FileHeader) (string, *plainInspector, error) {
+	src, err := header.Open()
+	if err != nil {
+		return "", nil, err
+	}
+	defer src.Close()
+	userKey := hmac.New(sha256.New, []byte(config.C.DedupSecret))
+	fmt.Fprintf(userKey, "dedup:%d", ownerID)
+	mac := hmac.New(sha256.New, userKey.Sum(nil))
+	plain := newPlainInspector(src)
+	if _, err := io.Copy(mac, plain); err != nil {
+		return "", nil, err
+	}
+	return hex.EncodeToString(mac.Sum(nil)), plain, nil
+}
+
+// newBlobPath names a blob after nothing but a random ID. Every write gets its own path, so a request
+// that loses a race for a version number, or a replaced blob, can be destroyed without touching the blob
+// that won, and several files can point at one deduplicated blob.
+func newBlobPath() string {
+	return filepath.Join("storage", fmt.Sprintf("blob_%s.enc", uuid.New().String()))
+}
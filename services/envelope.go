@@ -0,0 +1,307 @@
+package services
+
+import (
+	"bufio"
+	"crypto/rand"
+	"errors"
+	"io"
+	"os"
+
+	"file_project/config"
+	"file_project/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Envelope format (every blob written since per-file data keys were introduced):
+//
+//	[magic "FPS2"(4)][data key ID(16)][nonce prefix(7)] then chunks exactly as in the stream format
+//
+// Chunks are sealed under a random data key rather than one derived from the password. The data key
+// lives in the data_keys table, wrapped under an scrypt key of the password, with the key ID as
+// additional data. Changing the password only rewraps the key; deleting the key shreds the blob.
+const (
+	envelopeMagic      = "FPS2"
+	envelopeKeyIDSize  = 16
+	envelopeHeaderSize = len(envelopeMagic) + envelopeKeyIDSize + streamPrefixSize
+)
+
+// Deletion guarantees, weakest first, reported when a file is deleted permanently
+const (
+	DeletionRetainedShared = "retained_shared" // the blob is still used by another file (deduplication)
+	DeletionUnlinked       = "unlinked"        // the blob was removed from the directory only
+	DeletionOverwritten    = "overwritten"     // a legacy blob was overwritten with random data before removal
+	DeletionCryptoShredded = "crypto_shredded" // the blob's data key was destroyed
+)
+
+var deletionStrength = map[string]int{
+	DeletionRetainedShared: 0,
+	DeletionUnlinked:       1,
+	DeletionOverwritten:    2,
+	DeletionCryptoShredded: 3,
+}
+
+// ErrShredded is returned when a blob's data key has been destroyed
+var ErrShredded = errors.New("file data key has been destroyed")
+
+// keyWrapper wraps a fresh data key for the data_keys table
+type keyWrapper func(id uuid.UUID, key []byte) (*models.DataKey, error)
+
+// passwordWrapper wraps data keys under an scrypt key of password
+func passwordWrapper(password string) keyWrapper {
+	return func(id uuid.UUID, key []byte) (*models.DataKey, error) {
+		return wrapDataKey(id, key, password)
+	}
+}
+
+// encryptToFile streams src into a new envelope-format blob at path under a fresh data key.
+// It returns the stored size and the hex SHA-256 of the ciphertext as written.
+func (s *FileService) encryptToFile(path string, src io.Reader, password string) (int64, string, error) {
+	return s.encryptToFileWith(path, src, passwordWrapper(password))
+}
+
+// encryptToFileWith is encryptToFile with the data key wrapped by wrap
+func (s *FileService) encryptToFileWith(path string, src io.Reader, wrap keyWrapper) (int64, string, error) {
+	key := make([]byte, keyLen)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return 0, "", err
+	}
+	dk, err := wrap(uuid.New(), key)
+	if err != nil {
+		return 0, "", err
+	}
+	if err := s.Keys.Create(dk); err != nil {
+		return 0, "", err
+	}
+	header := make([]byte, envelopeHeaderSize)
+	copy(header, envelopeMagic)
+	copy(header[len(envelopeMagic):], dk.ID[:])
+	if _, err := io.ReadFull(rand.Reader, header[len(envelopeMagic)+envelopeKeyIDSize:]); err != nil {
+		_, _ = s.Keys.Release(dk.ID)
+		return 0, "", err
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		_, _ = s.Keys.Release(dk.ID)
+		return 0, "", err
+	}
+	cw := newCountingWriter(f)
+	ew, err := newEncryptWriter(cw, header, key)
+	if err == nil {
+		if _, err = io.Copy(ew, src); err == nil {
+			err = ew.Close()
+		}
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(path)
+		_, _ = s.Keys.Release(dk.ID)
+		return 0, "", err
+	}
+	return cw.n, cw.Sum(), nil
+}
+
+// openBlob returns a plaintext reader for any blob format. Envelope blobs are unlocked through their
+// wrapped data key; older formats are handed to OpenBlob. The password is checked before it returns.
+func (s *FileService) openBlob(path, password string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	br := bufio.NewReaderSize(f, streamSealedChunk+1)
+	header := make([]byte, envelopeHeaderSize)
+	if _, err := io.ReadFull(br, header); err == nil && string(header[:len(envelopeMagic)]) == envelopeMagic {
+		key, kerr := s.unwrapKey(header, password)
+		if kerr == nil {
+			r, err := openStream(br, header, key)
+			if err != nil {
+				f.Close()
+				return nil, err
+			}
+			return &blobReader{Reader: r, closer: f}, nil
+		}
+		f.Close()
+		// a legacy salt may start with the magic by chance
+		if r, err := OpenBlob(path, password); err == nil {
+			return r, nil
+		}
+		return nil, kerr
+	}
+	f.Close()
+	return OpenBlob(path, password)
+}
+
+// unwrapKey looks up the data key named in an envelope header and unwraps it with password
+func (s *FileService) unwrapKey(header []byte, password string) ([]byte, error) {
+	id, err := uuid.FromBytes(header[len(envelopeMagic) : len(envelopeMagic)+envelopeKeyIDSize])
+	if err != nil {
+		return nil, ErrWrongPassword
+	}
+	dk, err := s.Keys.FindByID(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrShredded
+	}
+	if err != nil {
+		return nil, err
+	}
+	return unwrapDataKey(dk, password)
+}
+
+// blobKeyID returns the data key ID of an envelope blob; ok is false for older formats
+func blobKeyID(path string) (uuid.UUID, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return uuid.Nil, false
+	}
+	defer f.Close()
+	header := make([]byte, envelopeHeaderSize)
+	if _, err := io.ReadFull(f, header); err != nil || string(header[:len(envelopeMagic)]) != envelopeMagic {
+		return uuid.Nil, false
+	}
+	id, err := uuid.FromBytes(header[len(envelopeMagic) : len(envelopeMagic)+envelopeKeyIDSize])
+	if err != nil {
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+// rewrapBlob moves an envelope blob to a new password by rewrapping its data key in place.
+// ok is false when the blob cannot be rewrapped alone (older format, or a key shared with copies)
+// and has to be re-encrypted instead.
+func (s *FileService) rewrapBlob(path, oldPassword, newPassword string) (bool, error) {
+	id, isEnvelope := blobKeyID(path)
+	if !isEnvelope {
+		return false, nil
+	}
+	dk, err := s.Keys.FindByID(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, ErrShredded
+	}
+	if err != nil {
+		return false, err
+	}
+	if dk.RefCount > 1 {
+		return false, nil
+	}
+	key, err := unwrapDataKey(dk, oldPassword)
+	if err != nil {
+		return false, err
+	}
+	fresh, err := wrapDataKey(dk.ID, key, newPassword)
+	if err != nil {
+		return false, err
+	}
+	dk.Salt, dk.Wrapped = fresh.Salt, fresh.Wrapped
+	return true, s.Keys.Update(dk)
+}
+
+// copyBlob copies a blob byte for byte; copies of an envelope blob share its data key
+func (s *FileService) copyBlob(from, to string) (int64, string, error) {
+	n, sum, err := copyFile(from, to)
+	if err != nil {
+		return 0, "", err
+	}
+	if id, ok := blobKeyID(to); ok {
+		if err := s.Keys.AddRef(id); err != nil {
+			_ = os.Remove(to)
+			return 0, "", err
+		}
+	}
+	return n, sum, nil
+}
+
+// destroyBlob removes a blob from disk as thoroughly as its format allows and reports the guarantee.
+// Envelope blobs are crypto-shredded once no copy uses their key; other blobs are overwritten first
+// when SECURE_OVERWRITE is enabled.
+func (s *FileService) destroyBlob(path string) string {
+	if id, ok := blobKeyID(path); ok {
+		remaining, err := s.Keys.Release(id)
+		if err == nil && remaining <= 0 {
+			_ = os.Remove(path)
+			return DeletionCryptoShredded
+		}
+	}
+	if config.C.SecureOverwrite && overwriteFile(path) == nil {
+		_ = os.Remove(path)
+		return DeletionOverwritten
+	}
+	_ = os.Remove(path)
+	return DeletionUnlinked
+}
+
+// overwriteFile replaces a file's contents with random bytes and syncs them to disk
+func overwriteFile(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if _, err := io.CopyN(f, rand.Reader, st.Size()); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// weakerDeletion returns the weaker of two deletion guarantees; an empty value means none yet
+func weakerDeletion(a, b string) string {
+	if a == "" {
+		return b
+	}
+	if b == "" || deletionStrength[a] <= deletionStrength[b] {
+		return a
+	}
+	return b
+}
+
+func wrapDataKey(id uuid.UUID, key []byte, password string) (*models.DataKey, error) {
+	salt := make([]byte, saltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	kek, err := DeriveKey(password, salt)
+	if err != nil {
+		return nil, err
+	}
+	return wrapDataKeyKEK(id, key, kek, salt)
+}
+
+// wrapDataKeyKEK wraps key under a key-encryption key already derived from a password and salt
+func wrapDataKeyKEK(id uuid.UUID, key, kek, salt []byte) (*models.DataKey, error) {
+	gcm, err := newGCM(kek)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, nonceSize)
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	wrapped := gcm.Seal(nonce, nonce, key, id[:])
+	return &models.DataKey{ID: id, Salt: salt, Wrapped: wrapped, RefCount: 1}, nil
+}
+
+func unwrapDataKey(dk *models.DataKey, password string) ([]byte, error) {
+	if len(dk.Wrapped) < nonceSize {
+		return nil, ErrWrongPassword
+	}
+	kek, err := DeriveKey(password, dk.Salt)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(kek)
+	if err != nil {
+		return nil, err
+	}
+	key, err := gcm.Open(nil, dk.Wrapped[:nonceSize], dk.Wrapped[nonceSize:], dk.ID[:])
+	if err != nil {
+		return nil, ErrWrongPassword
+	}
+	return key, nil
+}
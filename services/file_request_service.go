@@ -0,0 +1,430 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"file_project/config"
+	"file_project/models"
+	"file_project/repositories"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Reasons a file request refuses an upload
+const (
+	RequestNotFound         = "not_found"
+	RequestClosed           = "request_closed" // disabled, or its folder was deleted
+	RequestExpired          = "request_expired"
+	RequestFull             = "file_limit_reached"
+	RequestTooLarge         = "file_too_large"
+	RequestTypeNotAllowed   = "type_not_allowed"
+	RequestUploaderRequired = "uploader_required"
+)
+
+const maxAllowedTypes = 50
+
+var ErrInvalidFileRequest = errors.New("invalid file request")
+
+// UploadRefused is returned when a file request does not accept an upload
+type UploadRefused struct {
+	Reason  string
+	Message string
+}
+
+func (e *UploadRefused) Error() string { return e.Message }
+
+func refused(reason, message string) *UploadRefused {
+	return &UploadRefused{Reason: reason, Message: message}
+}
+
+// FileRequestOptions are the settings of a new file request. Password is what the uploaded files
+// are encrypted under; the owner opens them with it like any other file.
+type FileRequestOptions struct {
+	FolderID        uuid.UUID
+	Title           string
+	ExpiresAt       *time.Time
+	MaxFiles        *int
+	MaxFileSize     int64
+	AllowedTypes    []string
+	RequireUploader bool
+	Password        string
+}
+
+// Uploader is what the person uploading through a request tells about themselves
+type Uploader struct {
+	Name    string
+	Email   string
+	Message string
+}
+
+// FileRequestInfo is what an uploader is shown about a request; nothing about the folder's contents
+type FileRequestInfo struct {
+	Title           string     `json:"title"`
+	ExpiresAt       *time.Time `json:"expires_at,omitempty"`
+	RemainingFiles  *int       `json:"remaining_files,omitempty"`
+	MaxFileSize     int64      `json:"max_file_size"`
+	AllowedTypes    []string   `json:"allowed_types,omitempty"`
+	RequireUploader bool       `json:"require_uploader"`
+}
+
+// FileRequestUsage is a file request with its usage, as listed to its owner.
+// Status uses the share link states.
+type FileRequestUsage struct {
+	models.FileRequest
+	FolderName     string `json:"folder_name,omitempty"`
+	RemainingFiles *int   `json:"remaining_files,omitempty"`
+	Status         string `json:"status"`
+}
+
+type FileRequestService struct {
+	Requests repositories.FileRequestRepository
+	Files    *FileService
+}
+
+func NewFileRequestService(requests repositories.FileRequestRepository, files *FileService) *FileRequestService {
+	return &FileRequestService{Requests: requests, Files: files}
+}
+
+// Create opens an upload-only link into one of the owner's folders
+func (s *FileRequestService) Create(ownerID uint, opts FileRequestOptions) (*models.FileRequest, error) {
+	if len(opts.Password) < 6 {
+		return nil, fmt.Errorf("%w: password must be >= 6 chars", ErrInvalidFileRequest)
+	}
+	if opts.MaxFiles != nil && *opts.MaxFiles < 1 {
+		return nil, fmt.Errorf("%w: max_files must be >= 1", ErrInvalidFileRequest)
+	}
+	if opts.MaxFileSize < 0 {
+		return nil, fmt.Errorf("%w: max_file_size must be >= 0", ErrInvalidFileRequest)
+	}
+	if len(opts.Title) > 255 {
+		return nil, fmt.Errorf("%w: title is longer than 255 characters", ErrInvalidFileRequest)
+	}
+	types, err := normalizeTypes(opts.AllowedTypes)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.Files.Folders.FindByID(opts.FolderID, ownerID); err != nil {
+		return nil, err
+	}
+	token, err := generateToken(32)
+	if err != nil {
+		return nil, err
+	}
+	// keep a key derived from the password rather than the password itself
+	salt := make([]byte, saltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	kek, err := DeriveKey(opts.Password, salt)
+	if err != nil {
+		return nil, err
+	}
+	id := uuid.New()
+	sealed, err := sealRequestKEK(id, kek)
+	if err != nil {
+		return nil, err
+	}
+	req := &models.FileRequest{
+		ID:              id,
+		TokenHash:       hashToken(token),
+		OwnerID:         ownerID,
+		FolderID:        opts.FolderID,
+		Title:           opts.Title,
+		ExpiresAt:       opts.ExpiresAt,
+		MaxFiles:        opts.MaxFiles,
+		MaxFileSize:     opts.MaxFileSize,
+		AllowedTypes:    types,
+		RequireUploader: opts.RequireUploader,
+		KeySalt:         salt,
+		SealedKEK:       sealed,
+	}
+	if err := s.Requests.Create(req); err != nil {
+		return nil, err
+	}
+	req.Token = token
+	return req, nil
+}
+
+// List returns the user's file requests with their usage
+func (s *FileRequestService) List(ownerID uint) ([]FileRequestUsage, error) {
+	list, err := s.Requests.ListByOwner(ownerID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	out := make([]FileRequestUsage, 0, len(list))
+	for _, r := range list {
+		u := FileRequestUsage{FileRequest: r, FolderName: r.Folder.Name, RemainingFiles: remainingFiles(&r), Status: ShareActive}
+		switch {
+		case r.Folder.ID == uuid.Nil:
+			u.Status = ShareUnavailable
+		case r.Disabled:
+			u.Status = ShareDisabled
+		case r.ExpiresAt != nil && now.After(*r.ExpiresAt):
+			u.Status = ShareExpired
+		case u.RemainingFiles != nil && *u.RemainingFiles == 0:
+			u.Status = ShareExhausted
+		}
+		out = append(out, u)
+	}
+	return out, nil
+}
+
+// SetDisabled closes or reopens a file request
+func (s *FileRequestService) SetDisabled(id uuid.UUID, ownerID uint, disabled bool) (*models.FileRequest, error) {
+	req, err := s.Requests.FindByID(id, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	req.Disabled = disabled
+	if err := s.Requests.Update(req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+func (s *FileRequestService) Delete(id uuid.UUID, ownerID uint) error {
+	return s.Requests.Delete(id, ownerID)
+}
+
+// Info describes an open request to an uploader
+func (s *FileRequestService) Info(token string, now time.Time) (*FileRequestInfo, error) {
+	req, err := s.find(token, now)
+	if err != nil {
+		return nil, err
+	}
+	return &FileRequestInfo{
+		Title:           req.Title,
+		ExpiresAt:       req.ExpiresAt,
+		RemainingFiles:  remainingFiles(req),
+		MaxFileSize:     req.MaxFileSize,
+		AllowedTypes:    req.AllowedTypes,
+		RequireUploader: req.RequireUploader,
+	}, nil
+}
+
+// Upload stores one file in the request's folder, encrypted under the request's password. The
+// uploader's name, email and message are kept in the file's metadata. Refusals are *UploadRefused.
+func (s *FileRequestService) Upload(token string, header *multipart.FileHeader, up Uploader, now time.Time) (*models.EncryptedFile, error) {
+	req, err := s.find(token, now)
+	if err != nil {
+		return nil, err
+	}
+	up.Name, up.Email = strings.TrimSpace(up.Name), strings.TrimSpace(up.Email)
+	if req.RequireUploader && up.Name == "" && up.Email == "" {
+		return nil, refused(RequestUploaderRequired, "name or email required")
+	}
+	if up.Email != "" {
+		if _, err := mail.ParseAddress(up.Email); err != nil {
+			return nil, fmt.Errorf("%w: invalid email", ErrInvalidMetadata)
+		}
+	}
+	if req.MaxFileSize > 0 && header.Size > req.MaxFileSize {
+		return nil, refused(RequestTooLarge, fmt.Sprintf("files may be at most %d bytes", req.MaxFileSize))
+	}
+	if len(req.AllowedTypes) > 0 {
+		ok, err := typeAllowed(req.AllowedTypes, header)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, refused(RequestTypeNotAllowed, "this type of file is not accepted")
+		}
+	}
+	kek, err := openRequestKEK(req)
+	if err != nil {
+		return nil, err
+	}
+	// max files, enforced by the conditional update
+	claimed, err := s.Requests.Claim(req.ID, now)
+	if err != nil {
+		return nil, err
+	}
+	if claimed == nil {
+		return nil, refused(RequestFull, "no more files can be uploaded")
+	}
+
+	props := models.Properties{"file_request_id": req.ID.String()}
+	if up.Name != "" {
+		props["uploader_name"] = up.Name
+	}
+	if up.Email != "" {
+		props["uploader_email"] = up.Email
+	}
+	opts := UploadOptions{FolderID: &req.FolderID, Description: up.Message, Properties: props}
+	// no deduplication: that needs the password to check an existing blob
+	store := func(id uuid.UUID, src io.Reader) (*models.FileVersion, error) {
+		wrap := func(keyID uuid.UUID, key []byte) (*models.DataKey, error) {
+			return wrapDataKeyKEK(keyID, key, kek, req.KeySalt)
+		}
+		return s.Files.writeBlobWith(newBlobPath(), id, 1, header.Filename, src, wrap)
+	}
+	meta, _, err := s.Files.saveNew(req.OwnerID, header, opts, store)
+	if err != nil {
+		if uerr := s.Requests.Unclaim(req.ID); uerr != nil {
+			return nil, fmt.Errorf("%w (releasing the upload slot failed: %v)", err, uerr)
+		}
+		return nil, err
+	}
+	return meta, nil
+}
+
+// find looks a request up by its token and checks that it still accepts uploads
+func (s *FileRequestService) find(token string, now time.Time) (*models.FileRequest, error) {
+	req, err := s.Requests.FindByTokenHash(hashToken(token))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, refused(RequestNotFound, "file request not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	// a request for a folder its owner no longer has is never honoured
+	if req.Disabled || req.Folder.ID == uuid.Nil || req.Folder.OwnerID != req.OwnerID {
+		return nil, refused(RequestClosed, "file request closed")
+	}
+	if req.ExpiresAt != nil && now.After(*req.ExpiresAt) {
+		return nil, refused(RequestExpired, "file request expired")
+	}
+	if r := remainingFiles(req); r != nil && *r == 0 {
+		return nil, refused(RequestFull, "no more files can be uploaded")
+	}
+	return req, nil
+}
+
+func remainingFiles(req *models.FileRequest) *int {
+	if req.MaxFiles == nil {
+		return nil
+	}
+	remaining := *req.MaxFiles - req.Uploads
+	if remaining < 0 {
+		remaining = 0
+	}
+	return &remaining
+}
+
+// normalizeTypes lower-cases allowed types; each is an extension ("pdf" or ".pdf") or a MIME type
+// that may end in "/*"
+func normalizeTypes(in []string) (models.StringList, error) {
+	if len(in) > maxAllowedTypes {
+		return nil, fmt.Errorf("%w: at most %d allowed_types", ErrInvalidFileRequest, maxAllowedTypes)
+	}
+	out := make(models.StringList, 0, len(in))
+	for _, t := range in {
+		t = strings.ToLower(strings.TrimSpace(t))
+		switch {
+		case t == "" || strings.Contains(t, ","):
+			return nil, fmt.Errorf("%w: invalid allowed type %q", ErrInvalidFileRequest, t)
+		case strings.Contains(t, "/"):
+		case !strings.HasPrefix(t, "."):
+			t = "." + t
+		}
+		out = append(out, t)
+	}
+	return out, nil
+}
+
+// typeAllowed matches an upload's extension and sniffed MIME type against the allowed types
+func typeAllowed(allowed []string, header *multipart.FileHeader) (bool, error) {
+	src, err := header.Open()
+	if err != nil {
+		return false, err
+	}
+	defer src.Close()
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(src, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return false, err
+	}
+	ext := strings.ToLower(filepath.Ext(header.Filename))
+	base, _, _ := mime.ParseMediaType(DetectMimeType(head[:n], header.Filename))
+	for _, t := range allowed {
+		if strings.Contains(t, "/") {
+			if matchAnyMime([]string{t}, base) {
+				return true, nil
+			}
+		} else if t == ext {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// sealRequestKEK encrypts a request's key-encryption key under the server's file request key,
+// bound to the request ID
+func sealRequestKEK(id uuid.UUID, kek []byte) ([]byte, error) {
+	gcm, err := newGCM(fileRequestKey(config.C.FileRequestSecret))
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, nonceSize)
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, kek, id[:]), nil
+}
+
+func openRequestKEK(req *models.FileRequest) ([]byte, error) {
+	return openRequestKEKWith(req, fileRequestKey(config.C.FileRequestSecret))
+}
+
+func openRequestKEKWith(req *models.FileRequest, key []byte) ([]byte, error) {
+	if len(req.SealedKEK) < nonceSize {
+		return nil, errors.New("file request key truncated")
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	return gcm.Open(nil, req.SealedKEK[:nonceSize], req.SealedKEK[nonceSize:], req.ID[:])
+}
+
+func fileRequestKey(secret string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("file-request"))
+	return mac.Sum(nil)
+}
+
+// ResealKeys moves request keys that were sealed under JWT_SECRET, back when FILE_REQUEST_SECRET fell
+// back to it, to the current file request key. Keys that open with neither are left as they are.
+func (s *FileRequestService) ResealKeys() (int, error) {
+	list, err := s.Requests.ListAll()
+	if err != nil {
+		return 0, err
+	}
+	legacy := fileRequestKey(config.C.JWTSecret)
+	n := 0
+	for i := range list {
+		req := &list[i]
+		if _, err := openRequestKEK(req); err == nil {
+			continue
+		}
+		kek, err := openRequestKEKWith(req, legacy)
+		if err != nil {
+			continue
+		}
+		sealed, err := sealRequestKEK(req.ID, kek)
+		if err != nil {
+			return n, err
+		}
+		ok, err := s.Requests.ReplaceSealedKEK(req.ID, req.SealedKEK, sealed)
+		if err != nil {
+			return n, err
+		}
+		if ok {
+			n++
+		}
+	}
+	return n, nil
+}
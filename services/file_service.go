@@ -4,10 +4,10 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log"
 	"mime/multipart"
 	"os"
-	"path/filepath"
-	"strings"
+	"time"
 
 	"file_project/models"
 	"file_project/repositories"
@@ -15,104 +15,651 @@ import (
 	"github.com/google/uuid"
 )
 
+var (
+	ErrQuarantined     = errors.New("file is quarantined: malware detected")
+	ErrScanUnavailable = errors.New("malware scanner unavailable")
+	ErrVersionConflict = errors.New("another version was stored at the same time, try again")
+)
+
 type FileService struct {
-	Files repositories.FileRepository
+	Files    repositories.FileRepository
+	Versions repositories.FileVersionRepository
+	Folders  repositories.FolderRepository
+	Previews repositories.FilePreviewRepository
+	Blobs    repositories.BlobRepository
+	Keys     repositories.DataKeyRepository
+
+	// Scanner, when set, checks every upload before it is encrypted. With ScanFailOpen an
+	// unreachable scanner marks the file "error" instead of rejecting the upload.
+	Scanner      Scanner
+	ScanFailOpen bool
+
+	// Policy, when set, restricts which files may be stored
+	Policy *ContentPolicy
+
+	// Grants, when set, lets users a file is shared with reach the paths their permission allows
+	Grants repositories.FileShareRepository
+}
+
+func NewFileService(files repositories.FileRepository, versions repositories.FileVersionRepository, folders repositories.FolderRepository, previews repositories.FilePreviewRepository, blobs repositories.BlobRepository, keys repositories.DataKeyRepository) *FileService {
+	return &FileService{Files: files, Versions: versions, Folders: folders, Previews: previews, Blobs: blobs, Keys: keys}
 }
 
-func NewFileService(files repositories.FileRepository) *FileService {
-	return &FileService{Files: files}
+// UploadOptions holds the optional behaviour a client can ask for when storing a file or version
+type UploadOptions struct {
+	Preview   bool       // generate thumbnails / a text excerpt, encrypted under the same password
+	ExpiresAt *time.Time // move the file to the trash automatically at this time (new files only)
+
+	// Description and Properties are sealed into the file's metadata (new files only)
+	Description string
+	Properties  models.Properties
+
+	FolderID *uuid.UUID // place the new file in this folder
 }
 
 // SaveAndEncrypt saves the uploaded file to storage encrypted under the provided password
-func (s *FileService) SaveAndEncrypt(ownerID uint, header *multipart.FileHeader, password string) (*models.EncryptedFile, error) {
-	if header == nil || header.Size == 0 {
-		return nil, errors.New("empty file")
+func (s *FileService) SaveAndEncrypt(ownerID uint, header *multipart.FileHeader, password string, opts UploadOptions) (*models.EncryptedFile, error) {
+	store := func(id uuid.UUID, src io.Reader) (*models.FileVersion, error) {
+		return s.storeBlob(ownerID, id, 1, header.Filename, header, src, password)
 	}
-	// Read all bytes (for simplicity). For very large files, stream-chunk approach would be needed.
-	src, err := header.Open()
+	meta, v, err := s.saveNew(ownerID, header, opts, store)
 	if err != nil {
 		return nil, err
 	}
-	defer src.Close()
-	plain, err := io.ReadAll(src) // row bytes of uploaded file
+	if opts.Preview && v.ScanStatus != models.ScanInfected {
+		s.generatePreviews(v, uploadOpener(header), password)
+	}
+	return meta, nil
+}
+
+// saveNew checks an upload against the content policy and scanner, has store write its blob and
+// records the new file with its first version
+func (s *FileService) saveNew(ownerID uint, header *multipart.FileHeader, opts UploadOptions, store func(id uuid.UUID, src io.Reader) (*models.FileVersion, error)) (*models.EncryptedFile, *models.FileVersion, error) {
+	src, err := openUpload(header)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	defer src.Close()
+	if err := s.checkPolicy(header); err != nil {
+		return nil, nil, err
+	}
+	if err := validateMetadata(opts.Description, opts.Properties); err != nil {
+		return nil, nil, err
 	}
-	enc, err := EncryptBytes(plain, password)
+	scan, err := s.scanUpload(header)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	id := uuid.New()
-	// Ensure storage directory exists
-	_ = os.MkdirAll("storage", 0755)
-	filenameSafe := strings.ReplaceAll(header.Filename, "..", "_")
-	path := filepath.Join("storage", fmt.Sprintf("%s_%s.enc", id.String(), filenameSafe))
-	if err := os.WriteFile(path, enc, 0600); err != nil {
-		return nil, err
+	sealed, err := sealMetadata(id, fileMetadata{Description: opts.Description, Properties: opts.Properties})
+	if err != nil {
+		return nil, nil, err
+	}
+	v, err := store(id, src)
+	if err != nil {
+		return nil, nil, err
 	}
+	v.ScanStatus, v.ScanResult = scan.status, scan.detail
 	meta := &models.EncryptedFile{
-		ID:       id,
-		OwnerID:  ownerID,
-		Filename: header.Filename,
-		Path:     path,
-		Size:     int64(len(enc)),
+		ID:           id,
+		OwnerID:      ownerID,
+		Filename:     header.Filename,
+		Path:         v.Path,
+		Size:         v.Size,
+		OriginalSize: v.OriginalSize,
+		MimeType:     v.MimeType,
+		SHA256:       v.SHA256,
+		ScanStatus:   v.ScanStatus,
+		ScanResult:   v.ScanResult,
+		Version:      1,
+		ExpiresAt:    opts.ExpiresAt,
+		FolderID:     opts.FolderID,
+		Metadata:     sealed,
+		Description:  opts.Description,
+		Properties:   opts.Properties,
 	}
 	if err := s.Files.Create(meta); err != nil {
-		_ = os.Remove(path)
-		return nil, err
+		s.releaseBlob(v.Path)
+		return nil, nil, err
 	}
-	return meta, nil
+	if err := s.Versions.Create(v); err != nil {
+		// a file without its version row would be invisible to scrubbing and restore
+		if perr := s.Files.Purge(meta.ID, ownerID); perr != nil {
+			log.Printf("upload: file %s left without a version: %v", meta.ID, perr)
+		}
+		s.releaseBlob(v.Path)
+		return nil, nil, err
+	}
+	return meta, v, nil
 }
 
 // DecryptAndRead loads the encrypted file and decrypts with password
 func (s *FileService) DecryptAndRead(ownerID uint, id uuid.UUID, password string) ([]byte, string, error) {
-	meta, err := s.Files.FindByID(id, ownerID)
+	r, meta, err := s.Open(ownerID, id, password)
 	if err != nil {
 		return nil, "", err
 	}
-	enc, err := os.ReadFile(meta.Path)
+	defer r.Close()
+	plain, err := io.ReadAll(r)
 	if err != nil {
 		return nil, "", err
 	}
-	plain, err := DecryptBytes(enc, password)
+	return plain, meta.Filename, nil
+}
+
+// Open returns a streaming plaintext reader for the current version of a file.
+// The password is verified before Open returns; the caller must close the reader.
+func (s *FileService) Open(ownerID uint, id uuid.UUID, password string) (io.ReadCloser, *models.EncryptedFile, error) {
+	meta, err := s.Files.FindByID(id, ownerID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if meta.ScanStatus == models.ScanInfected {
+		return nil, nil, ErrQuarantined
+	}
+	r, err := s.openBlob(meta.Path, password)
 	if err != nil {
-		return nil, "", err
+		return nil, nil, err
 	}
-	return plain, meta.Filename, nil
+	return r, meta, nil
 }
 
-// ChangePassword re-encrypts file content with a new password
+// ChangePassword re-encrypts the current version with a new password.
+// Older versions keep the password they were uploaded with.
 func (s *FileService) ChangePassword(ownerID uint, id uuid.UUID, oldPassword, newPassword string) error {
-	meta, err := s.Files.FindByID(id, ownerID)
+	r, meta, err := s.Open(ownerID, id, oldPassword)
 	if err != nil {
 		return err
 	}
-	enc, err := os.ReadFile(meta.Path)
-	if err != nil {
+	defer r.Close()
+	if err := s.checkHold(meta); err != nil {
+		return err
+	}
+	if err := s.checkLock(meta, ownerID); err != nil {
 		return err
 	}
-	plain, err := DecryptBytes(enc, oldPassword)
+	v, err := s.Versions.FindByVersion(meta.ID, meta.Version)
 	if err != nil {
 		return err
 	}
-	reenc, err := EncryptBytes(plain, newPassword)
+	// a blob of its own in the envelope format only needs its data key rewrapped
+	shared, err := s.Blobs.IsTracked(meta.Path)
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(meta.Path, reenc, 0600)
+	rewrapped := false
+	if !shared {
+		if rewrapped, err = s.rewrapBlob(meta.Path, oldPassword, newPassword); err != nil {
+			return err
+		}
+	}
+	if !rewrapped {
+		// a deduplicated blob may be shared with other files and older formats cannot be rewrapped:
+		// re-encrypt into a new blob and let go of the old one only once the new one is recorded
+		oldPath, path := meta.Path, newBlobPath()
+		size, sum, err := s.encryptToFile(path, r, newPassword)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		v.Path, v.Size, v.BlobSHA256, v.Integrity, v.CheckedAt = path, size, sum, models.IntegrityOK, &now
+		if err := s.Versions.Update(v); err != nil {
+			s.destroyBlob(path)
+			return err
+		}
+		meta.Path, meta.Size = path, size
+		if err := s.Files.Update(meta, "Path", "Size"); err != nil {
+			return err
+		}
+		s.releaseBlob(oldPath)
+	}
+	// previews follow the blob to the new password; ones that cannot be moved are dropped
+	if err := s.reencryptPreviews(meta.ID, meta.Version, oldPassword, newPassword); err != nil {
+		s.removePreviews(meta.ID, meta.Version)
+	}
+	return nil
 }
 
-// Delete removes the file from disk and database
+// Delete moves the file to the trash. Its blobs stay on disk until the trash is purged.
 func (s *FileService) Delete(ownerID uint, id uuid.UUID) error {
 	meta, err := s.Files.FindByID(id, ownerID)
 	if err != nil {
 		return err
 	}
-	_ = os.Remove(meta.Path)
+	if err := s.checkHold(meta); err != nil {
+		return err
+	}
+	if err := s.checkLock(meta, ownerID); err != nil {
+		return err
+	}
 	return s.Files.Delete(meta.ID, ownerID)
 }
 
-// List returns encrypted files for owner
-func (s *FileService) List(ownerID uint) ([]models.EncryptedFile, error) {
-	return s.Files.ListByOwner(ownerID)
+// ListTrash returns the owner's trashed files
+func (s *FileService) ListTrash(ownerID uint) ([]models.EncryptedFile, error) {
+	return s.Files.ListTrash(ownerID)
+}
+
+// Restore moves a trashed file back into the vault and restarts its folder and account retention period.
+// An expiry date that has already passed is cleared, otherwise the retention job would trash the file
+// again straight away.
+func (s *FileService) Restore(ownerID uint, id uuid.UUID) error {
+	meta, err := s.Files.FindTrashed(id, ownerID)
+	if err != nil {
+		return err
+	}
+	if err := s.Files.Restore(meta.ID, ownerID); err != nil {
+		return err
+	}
+	if meta.ExpiresAt == nil || meta.ExpiresAt.After(time.Now()) {
+		return nil
+	}
+	_, err = s.SetExpiry(ownerID, meta.ID, nil)
+	return err
+}
+
+// DeletePermanently purges a trashed file right away and returns the deletion guarantee that applied
+func (s *FileService) DeletePermanently(ownerID uint, id uuid.UUID) (string, error) {
+	meta, err := s.Files.FindTrashed(id, ownerID)
+	if err != nil {
+		return "", err
+	}
+	return s.purge(meta)
+}
+
+// EmptyTrash purges every trashed file of the owner. It returns how many were removed and the
+// weakest deletion guarantee among them.
+func (s *FileService) EmptyTrash(ownerID uint) (int, string, error) {
+	list, err := s.Files.ListTrash(ownerID)
+	if err != nil {
+		return 0, "", err
+	}
+	return s.purgeAll(list)
+}
+
+// PurgeTrash purges files of all users that have been in the trash longer than retention
+func (s *FileService) PurgeTrash(retention time.Duration) (int, error) {
+	list, err := s.Files.ListTrashedBefore(time.Now().Add(-retention))
+	if err != nil {
+		return 0, err
+	}
+	n, _, err := s.purgeAll(list)
+	return n, err
+}
+
+// purgeAll purges the given files, leaving held ones in the trash
+func (s *FileService) purgeAll(list []models.EncryptedFile) (int, string, error) {
+	n, guarantee := 0, ""
+	for i := range list {
+		g, err := s.purge(&list[i])
+		if errors.Is(err, ErrLegalHold) {
+			continue
+		}
+		if err != nil {
+			return n, guarantee, err
+		}
+		guarantee = weakerDeletion(guarantee, g)
+		n++
+	}
+	return n, guarantee, nil
+}
+
+// purge destroys every version blob and preview of a file and removes its rows from the database.
+// It returns the weakest deletion guarantee that applied to the file's blobs.
+func (s *FileService) purge(meta *models.EncryptedFile) (string, error) {
+	if err := s.checkHold(meta); err != nil {
+		return "", err
+	}
+	versions, err := s.Versions.ListByFile(meta.ID)
+	if err != nil {
+		return "", err
+	}
+	if err := s.Versions.DeleteByFile(meta.ID); err != nil {
+		return "", err
+	}
+	if err := s.Files.Purge(meta.ID, meta.OwnerID); err != nil {
+		return "", err
+	}
+	guarantee := s.removePreviews(meta.ID, 0)
+	for _, v := range versions {
+		guarantee = weakerDeletion(guarantee, s.releaseBlob(v.Path))
+	}
+	if len(versions) == 0 {
+		guarantee = weakerDeletion(guarantee, s.releaseBlob(meta.Path))
+	}
+	return guarantee, nil
+}
+
+// List returns encrypted files for owner that match filter, with their metadata decrypted
+func (s *FileService) List(ownerID uint, filter MetadataFilter) ([]models.EncryptedFile, error) {
+	list, err := s.Files.ListByOwner(ownerID)
+	if err != nil {
+		return nil, err
+	}
+	return filterFiles(list, filter), nil
+}
+
+// AddVersion stores a new revision under the same logical file and makes it current.
+// The file ID, and therefore every share link that follows the latest version, is preserved.
+// userID is the owner or a user the file is shared with for editing; the blob belongs to the owner.
+func (s *FileService) AddVersion(userID uint, id uuid.UUID, header *multipart.FileHeader, password string, opts UploadOptions) (*models.FileVersion, error) {
+	meta, err := s.writable(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkHold(meta); err != nil {
+		return nil, err
+	}
+	if err := s.checkLock(meta, userID); err != nil {
+		return nil, err
+	}
+	src, err := openUpload(header)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+	if err := s.checkPolicy(header); err != nil {
+		return nil, err
+	}
+	scan, err := s.scanUpload(header)
+	if err != nil {
+		return nil, err
+	}
+	v, err := s.storeBlob(meta.OwnerID, meta.ID, meta.Version+1, meta.Filename, header, src, password)
+	if err != nil {
+		return nil, err
+	}
+	v.ScanStatus, v.ScanResult = scan.status, scan.detail
+	if err := s.commitVersion(meta, v); err != nil {
+		s.releaseBlob(v.Path)
+		return nil, err
+	}
+	if opts.Preview && v.ScanStatus != models.ScanInfected {
+		s.generatePreviews(v, uploadOpener(header), password)
+	}
+	return v, nil
+}
+
+// ListVersions returns every stored revision of a file, newest first
+func (s *FileService) ListVersions(ownerID uint, id uuid.UUID) ([]models.FileVersion, error) {
+	meta, err := s.Files.FindByID(id, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	return s.Versions.ListByFile(meta.ID)
+}
+
+// OpenVersion returns a streaming plaintext reader for a specific revision, which must be opened
+// with the password it was stored under. The caller must close the reader.
+func (s *FileService) OpenVersion(ownerID uint, id uuid.UUID, version int, password string) (io.ReadCloser, *models.EncryptedFile, *models.FileVersion, error) {
+	meta, err := s.Files.FindByID(id, ownerID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	v, err := s.Versions.FindByVersion(meta.ID, version)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if v.ScanStatus == models.ScanInfected {
+		return nil, nil, nil, ErrQuarantined
+	}
+	r, err := s.openBlob(v.Path, password)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return r, meta, v, nil
+}
+
+// BackfillSizes fills in OriginalSize for files stored before it was recorded. The MIME type and
+// plaintext hash of those files cannot be recovered without their password and stay empty.
+func (s *FileService) BackfillSizes() (int, error) {
+	list, err := s.Files.ListMissingOriginalSize()
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for i := range list {
+		size, err := PlaintextSize(list[i].Path)
+		if err != nil {
+			continue
+		}
+		if err := s.Files.SetOriginalSize(list[i].ID, size); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// RestoreVersion copies an older revision forward as a new current version.
+// The ciphertext is copied as-is, so the restored version keeps its original password.
+func (s *FileService) RestoreVersion(userID uint, id uuid.UUID, version int) (*models.FileVersion, error) {
+	meta, err := s.writable(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkHold(meta); err != nil {
+		return nil, err
+	}
+	if err := s.checkLock(meta, userID); err != nil {
+		return nil, err
+	}
+	old, err := s.Versions.FindByVersion(meta.ID, version)
+	if err != nil {
+		return nil, err
+	}
+	next := meta.Version + 1
+	path := newBlobPath()
+	size, sum, err := s.copyBlob(old.Path, path)
+	if err != nil {
+		return nil, err
+	}
+	if old.BlobSHA256 != "" && old.BlobSHA256 != sum {
+		s.destroyBlob(path)
+		return nil, errors.New("stored version failed its integrity check")
+	}
+	now := time.Now()
+	v := &models.FileVersion{
+		FileID:       meta.ID,
+		Version:      next,
+		Path:         path,
+		Size:         size,
+		OriginalSize: old.OriginalSize,
+		MimeType:     old.MimeType,
+		SHA256:       old.SHA256,
+		ScanStatus:   old.ScanStatus,
+		ScanResult:   old.ScanResult,
+		BlobSHA256:   sum,
+		Integrity:    models.IntegrityOK,
+		CheckedAt:    &now,
+	}
+	if err := s.commitVersion(meta, v); err != nil {
+		s.destroyBlob(path)
+		return nil, err
+	}
+	s.copyPreviews(meta.ID, old.Version, v.Version)
+	return v, nil
+}
+
+// GetVersionPolicy returns the owner's version retention policy
+func (s *FileService) GetVersionPolicy(ownerID uint) (*models.VersionPolicy, error) {
+	return s.Versions.GetPolicy(ownerID)
+}
+
+// SetVersionPolicy stores the owner's version retention policy (0 = unlimited)
+func (s *FileService) SetVersionPolicy(ownerID uint, keepVersions, keepDays int) (*models.VersionPolicy, error) {
+	if keepVersions < 0 || keepDays < 0 {
+		return nil, errors.New("keep_versions and keep_days must be >= 0")
+	}
+	p := &models.VersionPolicy{UserID: ownerID, KeepVersions: keepVersions, KeepDays: keepDays}
+	if err := s.Versions.SavePolicy(p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// commitVersion records a freshly written blob as the file's current version and applies retention.
+// It fails with ErrVersionConflict when another version became current since meta was read.
+func (s *FileService) commitVersion(meta *models.EncryptedFile, v *models.FileVersion) error {
+	if err := s.Versions.Create(v); err != nil {
+		return err
+	}
+	previous := meta.Version
+	meta.Version = v.Version
+	meta.Path = v.Path
+	meta.Size = v.Size
+	meta.OriginalSize = v.OriginalSize
+	meta.MimeType = v.MimeType
+	meta.SHA256 = v.SHA256
+	meta.ScanStatus = v.ScanStatus
+	meta.ScanResult = v.ScanResult
+	ok, err := s.Files.CommitVersion(meta, previous)
+	if err == nil && !ok {
+		err = ErrVersionConflict
+	}
+	if err != nil {
+		_ = s.Versions.Delete(v.ID)
+		return err
+	}
+	s.pruneVersions(meta)
+	return nil
+}
+
+// pruneVersions drops old revisions according to the owner's policy. Versions that a share link or a
+// share with a named user is pinned to are kept until nothing points at them. Failures are not fatal:
+// the new version is already committed and pruning will be retried on the next upload.
+func (s *FileService) pruneVersions(meta *models.EncryptedFile) {
+	policy, err := s.Versions.GetPolicy(meta.OwnerID)
+	if err != nil || (policy.KeepVersions == 0 && policy.KeepDays == 0) {
+		return
+	}
+	// held files keep their whole history
+	if s.checkHold(meta) != nil {
+		return
+	}
+	versions, err := s.Versions.ListByFile(meta.ID)
+	if err != nil {
+		return
+	}
+	cutoff := time.Now().AddDate(0, 0, -policy.KeepDays)
+	for i, v := range versions {
+		if v.Version == meta.Version {
+			continue
+		}
+		tooMany := policy.KeepVersions > 0 && i >= policy.KeepVersions
+		tooOld := policy.KeepDays > 0 && v.CreatedAt.Before(cutoff)
+		if !tooMany && !tooOld {
+			continue
+		}
+		if deleted, err := s.Versions.DeleteUnpinned(&v); err == nil && deleted {
+			s.releaseBlob(v.Path)
+			s.removePreviews(meta.ID, v.Version)
+		}
+	}
+}
+
+// openUpload opens the multipart upload for streaming
+func openUpload(header *multipart.FileHeader) (multipart.File, error) {
+	if header == nil || header.Size == 0 {
+		return nil, errors.New("empty file")
+	}
+	return header.Open()
+}
+
+type scanVerdict struct {
+	status string
+	detail string
+}
+
+// scanUpload runs the configured scanner over the plaintext of an upload before it is encrypted
+func (s *FileService) scanUpload(header *multipart.FileHeader) (scanVerdict, error) {
+	if s.Scanner == nil {
+		return scanVerdict{status: models.ScanPending}, nil
+	}
+	src, err := header.Open()
+	if err != nil {
+		return scanVerdict{}, err
+	}
+	defer src.Close()
+	res, err := s.Scanner.Scan(src)
+	if err != nil {
+		if s.ScanFailOpen {
+			return scanVerdict{status: models.ScanError, detail: err.Error()}, nil
+		}
+		return scanVerdict{}, fmt.Errorf("%w: %v", ErrScanUnavailable, err)
+	}
+	if res.Infected {
+		return scanVerdict{status: models.ScanInfected, detail: res.Signature}, nil
+	}
+	return scanVerdict{status: models.ScanClean}, nil
+}
+
+// Shareable returns the owner's file if it may be shared, i.e. it exists and is not quarantined
+func (s *FileService) Shareable(ownerID uint, id uuid.UUID) (*models.EncryptedFile, error) {
+	meta, err := s.Files.FindByID(id, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	if meta.ScanStatus == models.ScanInfected {
+		return nil, ErrQuarantined
+	}
+	return meta, nil
+}
+
+// uploadOpener lets preview generation read the upload a second time
+func uploadOpener(header *multipart.FileHeader) func() (io.ReadCloser, error) {
+	return func() (io.ReadCloser, error) { return header.Open() }
+}
+
+// writeBlob streams src encrypted under password to path in the storage directory.
+// It returns the unsaved version record, including size, hash and MIME type of the plaintext.
+func (s *FileService) writeBlob(path string, id uuid.UUID, version int, filename string, src io.Reader, password string) (*models.FileVersion, error) {
+	return s.writeBlobWith(path, id, version, filename, src, passwordWrapper(password))
+}
+
+// writeBlobWith is writeBlob with the blob's data key wrapped by wrap
+func (s *FileService) writeBlobWith(path string, id uuid.UUID, version int, filename string, src io.Reader, wrap keyWrapper) (*models.FileVersion, error) {
+	// Ensure storage directory exists
+	_ = os.MkdirAll("storage", 0755)
+	plain := newPlainInspector(src)
+	size, sum, err := s.encryptToFileWith(path, plain, wrap)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	return &models.FileVersion{
+		FileID:       id,
+		Version:      version,
+		Path:         path,
+		Size:         size,
+		OriginalSize: plain.n,
+		MimeType:     DetectMimeType(plain.head, filename),
+		SHA256:       plain.Sum(),
+		BlobSHA256:   sum,
+		Integrity:    models.IntegrityOK,
+		CheckedAt:    &now,
+	}, nil
+}
+
+// copyFile copies a blob byte for byte and returns the number of bytes written and their SHA-256
+func copyFile(from, to string) (int64, string, error) {
+	src, err := os.Open(from)
+	if err != nil {
+		return 0, "", err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(to, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return 0, "", err
+	}
+	cw := newCountingWriter(dst)
+	_, err = io.Copy(cw, src)
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(to)
+		return 0, "", err
+	}
+	return cw.n, cw.Sum(), nil
 }
@@ -0,0 +1,211 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"file_project/models"
+	"file_project/repositories"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrNotPermitted = errors.New("you do not have permission for this file")
+	ErrInvalidGrant = errors.New("invalid share")
+	ErrNoInvite     = errors.New("invitation not found")
+)
+
+var permissionRank = map[string]int{
+	models.PermissionView:     1,
+	models.PermissionDownload: 2,
+	models.PermissionEdit:     3,
+	models.PermissionManage:   4,
+}
+
+// GrantRequest describes a share of a file with a named person.
+// SharePassword, together with the file Password, gives the share its own secret; it is then pinned
+// to Version (the current version when nil).
+type GrantRequest struct {
+	Email         string
+	Permission    string
+	ExpiresAt     *time.Time
+	Password      string
+	SharePassword string
+	Version       *int
+}
+
+// SharedFile is a file someone else shared with the caller
+type SharedFile struct {
+	ShareID     uuid.UUID         `json:"share_id"`
+	FileID      uuid.UUID         `json:"file_id"`
+	OwnerID     uint              `json:"owner_id"`
+	Filename    string            `json:"filename"`
+	Size        int64             `json:"original_size"`
+	MimeType    string            `json:"mime_type"`
+	Description string            `json:"description,omitempty"`
+	Properties  models.Properties `json:"properties,omitempty"`
+	Permission  string            `json:"permission"`
+	ExpiresAt   *time.Time        `json:"expires_at,omitempty"`
+	OwnPassword bool              `json:"own_password"` // download with the share's password instead of the file's
+}
+
+type FileShareService struct {
+	Grants repositories.FileShareRepository
+	Users  repositories.UserRepository
+	Files  *FileService
+}
+
+func NewFileShareService(grants repositories.FileShareRepository, users repositories.UserRepository, files *FileService) *FileShareService {
+	return &FileShareService{Grants: grants, Users: users, Files: files}
+}
+
+// Grant shares a file with the person behind an email address, or replaces their existing share.
+// Addresses without an account get a pending invitation whose token is set on the returned share.
+// The actor must own the file or hold "manage".
+func (s *FileShareService) Grant(actorID uint, fileID uuid.UUID, req GrantRequest) (*models.FileShare, error) {
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+	if !strings.Contains(email, "@") || len(email) > 120 {
+		return nil, fmt.Errorf("%w: a valid email is required", ErrInvalidGrant)
+	}
+	if permissionRank[req.Permission] == 0 {
+		return nil, fmt.Errorf("%w: permission must be view, download, edit or manage", ErrInvalidGrant)
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return nil, fmt.Errorf("%w: expires_at must be in the future", ErrInvalidGrant)
+	}
+	meta, err := s.manageable(actorID, fileID)
+	if err != nil {
+		return nil, err
+	}
+	if meta.ScanStatus == models.ScanInfected {
+		return nil, ErrQuarantined
+	}
+	share := &models.FileShare{FileID: meta.ID, Email: email, Permission: req.Permission, ExpiresAt: req.ExpiresAt, GrantedBy: actorID}
+	u, err := s.Users.FindByEmail(email)
+	switch {
+	case err == nil:
+		if u.ID == meta.OwnerID {
+			return nil, fmt.Errorf("%w: the owner already has access", ErrInvalidGrant)
+		}
+		share.GranteeID = &u.ID
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		token, err := generateToken(32)
+		if err != nil {
+			return nil, err
+		}
+		share.InviteHash, share.InviteToken = hashToken(token), token
+	default:
+		return nil, err
+	}
+	if req.SharePassword != "" {
+		if len(req.SharePassword) < 6 {
+			return nil, fmt.Errorf("%w: share_password must be >= 6 chars", ErrInvalidGrant)
+		}
+		key, err := s.Files.ShareKey(meta.OwnerID, meta.ID, req.Version, req.Password, req.SharePassword)
+		if err != nil {
+			return nil, err
+		}
+		share.Version, share.KeyID, share.KeySalt, share.WrappedKey = &key.Version, &key.KeyID, key.Salt, key.Wrapped
+	}
+	if err := s.Grants.Upsert(share); err != nil {
+		return nil, err
+	}
+	return share, nil
+}
+
+// List returns everyone a file is shared with, including pending invitations
+func (s *FileShareService) List(actorID uint, fileID uuid.UUID) ([]models.FileShare, error) {
+	meta, err := s.manageable(actorID, fileID)
+	if err != nil {
+		return nil, err
+	}
+	return s.Grants.ListByFile(meta.ID)
+}
+
+// Revoke removes one share of a file
+func (s *FileShareService) Revoke(actorID uint, fileID, shareID uuid.UUID) error {
+	meta, err := s.manageable(actorID, fileID)
+	if err != nil {
+		return err
+	}
+	return s.Grants.Delete(shareID, meta.ID)
+}
+
+// SharedWithMe lists the files shared with the user whose shares have not expired.
+// Trashed and quarantined files are left out.
+func (s *FileShareService) SharedWithMe(userID uint) ([]SharedFile, error) {
+	shares, err := s.Grants.ListForGrantee(userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	out := make([]SharedFile, 0, len(shares))
+	for i := range shares {
+		sh := &shares[i]
+		if sh.File.ID == uuid.Nil || sh.File.ScanStatus == models.ScanInfected {
+			continue
+		}
+		if err := openMetadata(&sh.File); err != nil {
+			log.Printf("metadata of file %s unreadable: %v", sh.File.ID, err)
+		}
+		out = append(out, SharedFile{
+			ShareID:     sh.ID,
+			FileID:      sh.FileID,
+			OwnerID:     sh.File.OwnerID,
+			Filename:    sh.File.Filename,
+			Size:        sh.File.OriginalSize,
+			MimeType:    sh.File.MimeType,
+			Description: sh.File.Description,
+			Properties:  sh.File.Properties,
+			Permission:  sh.Permission,
+			ExpiresAt:   sh.ExpiresAt,
+			OwnPassword: sh.KeyID != nil,
+		})
+	}
+	return out, nil
+}
+
+// Open returns a plaintext reader for a file shared with the user, who needs at least "download".
+// secret is the share's own password when it has one, otherwise the file password. The version is
+// nil when the current version was opened. The caller must close the reader.
+func (s *FileShareService) Open(userID uint, fileID uuid.UUID, secret string) (io.ReadCloser, *models.EncryptedFile, *models.FileVersion, error) {
+	share, err := s.Grants.FindForGrantee(fileID, userID, time.Now())
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if share.File.ID == uuid.Nil {
+		return nil, nil, nil, gorm.ErrRecordNotFound
+	}
+	if permissionRank[share.Permission] < permissionRank[models.PermissionDownload] {
+		return nil, nil, nil, ErrNotPermitted
+	}
+	if share.KeyID != nil && share.Version != nil {
+		return s.Files.openKeyCopy(&share.File, *share.Version, *share.KeyID, share.KeySalt, share.WrappedKey, secret)
+	}
+	r, meta, err := s.Files.Open(share.File.OwnerID, share.FileID, secret)
+	return r, meta, nil, err
+}
+
+// ClaimInvite gives the user the pending share behind an invitation token. Registering with an email
+// proves nothing about owning it, so the token is needed as well as a matching account email.
+func (s *FileShareService) ClaimInvite(userID uint, token string) (*models.FileShare, error) {
+	u, err := s.Users.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	share, err := s.Grants.ClaimInvite(hashToken(token), userID, strings.ToLower(u.Email))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNoInvite
+	}
+	return share, err
+}
+
+// manageable returns the file if the user owns it or holds an unexpired "manage" share on it
+func (s *FileShareService) manageable(userID uint, fileID uuid.UUID) (*models.EncryptedFile, error) {
+	return s.Files.accessible(userID, fileID, models.PermissionManage)
+}
@@ -0,0 +1,135 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"file_project/models"
+
+	"github.com/google/uuid"
+)
+
+const maxTagLen = 64
+
+// CreateFolder creates a folder for owner, optionally nested under parentID
+func (s *FileService) CreateFolder(ownerID uint, name string, parentID *uuid.UUID) (*models.Folder, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 255 {
+		return nil, errors.New("folder name must be 1-255 chars")
+	}
+	if parentID != nil {
+		if _, err := s.Folders.FindByID(*parentID, ownerID); err != nil {
+			return nil, err
+		}
+	}
+	folder := &models.Folder{OwnerID: ownerID, Name: name, ParentID: parentID}
+	if err := s.Folders.Create(folder); err != nil {
+		return nil, err
+	}
+	return folder, nil
+}
+
+// ListFolders returns all folders of owner
+func (s *FileService) ListFolders(ownerID uint) ([]models.Folder, error) {
+	return s.Folders.ListByOwner(ownerID)
+}
+
+// DeleteFolder removes an empty folder that is not held
+func (s *FileService) DeleteFolder(ownerID uint, id uuid.UUID) error {
+	folder, err := s.Folders.FindByID(id, ownerID)
+	if err != nil {
+		return err
+	}
+	if folder.LegalHold || (folder.RetainUntil != nil && folder.RetainUntil.After(time.Now())) {
+		return ErrLegalHold
+	}
+	n, err := s.Folders.CountChildren(folder.ID)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return errors.New("folder is not empty")
+	}
+	return s.Folders.Delete(folder.ID, ownerID)
+}
+
+// SetFolderRetention expires files placed directly in the folder days after upload (0 = never)
+func (s *FileService) SetFolderRetention(ownerID uint, id uuid.UUID, days int) (*models.Folder, error) {
+	if days < 0 {
+		return nil, errors.New("retention_days must be >= 0")
+	}
+	folder, err := s.Folders.FindByID(id, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Folders.SetRetention(folder.ID, ownerID, days); err != nil {
+		return nil, err
+	}
+	folder.RetentionDays = days
+	return folder, nil
+}
+
+// Move puts a file into folderID, or back at the top level when folderID is nil
+func (s *FileService) Move(ownerID uint, id uuid.UUID, folderID *uuid.UUID) error {
+	meta, err := s.Files.FindByID(id, ownerID)
+	if err != nil {
+		return err
+	}
+	// moving a held file out of its folder would lift a folder hold
+	if err := s.checkHold(meta); err != nil {
+		return err
+	}
+	if err := s.checkLock(meta, ownerID); err != nil {
+		return err
+	}
+	if folderID != nil {
+		if _, err := s.Folders.FindByID(*folderID, ownerID); err != nil {
+			return err
+		}
+	}
+	meta.FolderID = folderID
+	return s.Files.Update(meta, "FolderID")
+}
+
+// AddTags attaches labels to a file; tags already present are ignored
+func (s *FileService) AddTags(ownerID uint, id uuid.UUID, tags []string) error {
+	meta, err := s.Files.FindByID(id, ownerID)
+	if err != nil {
+		return err
+	}
+	clean, err := normalizeTags(tags)
+	if err != nil {
+		return err
+	}
+	return s.Files.AddTags(meta.ID, clean)
+}
+
+// RemoveTags detaches labels from a file
+func (s *FileService) RemoveTags(ownerID uint, id uuid.UUID, tags []string) error {
+	meta, err := s.Files.FindByID(id, ownerID)
+	if err != nil {
+		return err
+	}
+	clean, err := normalizeTags(tags)
+	if err != nil {
+		return err
+	}
+	return s.Files.RemoveTags(meta.ID, clean)
+}
+
+// normalizeTags trims and lower-cases tags and rejects empty or oversized ones
+func normalizeTags(tags []string) ([]string, error) {
+	if len(tags) == 0 {
+		return nil, errors.New("tags required")
+	}
+	out := make([]string, 0, len(tags))
+	for _, t := range tags {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t == "" || len(t) > maxTagLen {
+			return nil, errors.New("tags must be 1-64 chars")
+		}
+		out = append(out, t)
+	}
+	return out, nil
+}
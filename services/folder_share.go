@@ -0,0 +1,107 @@
+package services
+
+import (
+	"errors"
+	"io"
+	"time"
+
+	"file_project/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ErrOutsideSharedFolder is returned for a folder or file that is not inside a shared folder
+var ErrOutsideSharedFolder = errors.New("not inside the shared folder")
+
+// SharedFolderListing is one level of a shared folder as shown to link holders
+type SharedFolderListing struct {
+	ID      uuid.UUID          `json:"id"`
+	Name    string             `json:"name"`
+	Folders []SharedFolderItem `json:"folders"`
+	Files   []SharedFileItem   `json:"files"`
+}
+
+type SharedFolderItem struct {
+	ID   uuid.UUID `json:"id"`
+	Name string    `json:"name"`
+}
+
+type SharedFileItem struct {
+	ID           uuid.UUID `json:"id"`
+	Filename     string    `json:"filename"`
+	OriginalSize int64     `json:"original_size"`
+	MimeType     string    `json:"mime_type"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// ListSharedFolder lists folderID (the shared root when nil), which must lie inside root.
+// Quarantined files are left out.
+func (s *FileService) ListSharedFolder(root *models.Folder, folderID *uuid.UUID) (*SharedFolderListing, error) {
+	folder := root
+	if folderID != nil && *folderID != root.ID {
+		f, err := s.Folders.FindByID(*folderID, root.OwnerID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrOutsideSharedFolder
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := s.insideFolder(root, f.ParentID); err != nil {
+			return nil, err
+		}
+		folder = f
+	}
+	folders, err := s.Folders.ListByOwner(root.OwnerID)
+	if err != nil {
+		return nil, err
+	}
+	files, err := s.Files.ListByFolder(root.OwnerID, folder.ID)
+	if err != nil {
+		return nil, err
+	}
+	out := &SharedFolderListing{ID: folder.ID, Name: folder.Name, Folders: []SharedFolderItem{}, Files: []SharedFileItem{}}
+	for _, f := range folders {
+		if f.ParentID != nil && *f.ParentID == folder.ID {
+			out.Folders = append(out.Folders, SharedFolderItem{ID: f.ID, Name: f.Name})
+		}
+	}
+	for _, f := range files {
+		if f.ScanStatus == models.ScanInfected {
+			continue
+		}
+		out.Files = append(out.Files, SharedFileItem{ID: f.ID, Filename: f.Filename, OriginalSize: f.OriginalSize, MimeType: f.MimeType, UpdatedAt: f.UpdatedAt})
+	}
+	return out, nil
+}
+
+// OpenInSharedFolder opens the current version of a file that lies anywhere inside root.
+// The caller must close the reader.
+func (s *FileService) OpenInSharedFolder(root *models.Folder, fileID uuid.UUID, password string) (io.ReadCloser, *models.EncryptedFile, error) {
+	meta, err := s.Files.FindByID(fileID, root.OwnerID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, ErrOutsideSharedFolder
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := s.insideFolder(root, meta.FolderID); err != nil {
+		return nil, nil, err
+	}
+	return s.Open(root.OwnerID, meta.ID, password)
+}
+
+// insideFolder checks that folderID is root or one of its descendants
+func (s *FileService) insideFolder(root *models.Folder, folderID *uuid.UUID) error {
+	for depth := 0; folderID != nil && depth < 64; depth++ {
+		if *folderID == root.ID {
+			return nil
+		}
+		f, err := s.Folders.FindByID(*folderID, root.OwnerID)
+		if err != nil {
+			return ErrOutsideSharedFolder
+		}
+		folderID = f.ParentID
+	}
+	return ErrOutsideSharedFolder
+}
@@ -0,0 +1,146 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"file_project/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// LockedError is returned when a write is attempted on a file another user has checked out
+type LockedError struct {
+	Lock *models.FileLock
+}
+
+func (e *LockedError) Error() string {
+	return "file is locked by another user"
+}
+
+// Lock checks a file out to userID for d, or renews the caller's own lock. The owner and users
+// holding "edit" may lock. It fails with *LockedError while someone else holds an unexpired lock.
+func (s *FileService) Lock(userID uint, id uuid.UUID, d time.Duration) (*models.FileLock, error) {
+	meta, err := s.writable(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	lock := &models.FileLock{FileID: meta.ID, UserID: userID, ExpiresAt: now.Add(d), CreatedAt: now}
+	ok, err := s.Files.AcquireLock(lock, now)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		current, err := s.Files.FindLock(meta.ID)
+		if err != nil {
+			return nil, err
+		}
+		return nil, &LockedError{Lock: current}
+	}
+	return lock, nil
+}
+
+// GetLock returns the lock in force on a file, or nil when it is not locked
+func (s *FileService) GetLock(userID uint, id uuid.UUID) (*models.FileLock, error) {
+	meta, err := s.accessible(userID, id, models.PermissionView)
+	if err != nil {
+		return nil, err
+	}
+	return s.activeLock(meta.ID)
+}
+
+// Unlock releases the caller's lock. With force (admins only) any user's lock is broken.
+// Unlocking a file that is not locked succeeds.
+func (s *FileService) Unlock(userID uint, id uuid.UUID, force bool) error {
+	var meta *models.EncryptedFile
+	var err error
+	if force {
+		meta, err = s.Files.FindAny(id)
+	} else {
+		meta, err = s.writable(userID, id)
+	}
+	if err != nil {
+		return err
+	}
+	lock, err := s.activeLock(meta.ID)
+	if err != nil {
+		return err
+	}
+	if lock != nil && lock.UserID != userID && !force {
+		return &LockedError{Lock: lock}
+	}
+	return s.Files.ReleaseLock(meta.ID)
+}
+
+// checkLock rejects a write by userID while another user holds the file's lock
+func (s *FileService) checkLock(meta *models.EncryptedFile, userID uint) error {
+	lock, err := s.activeLock(meta.ID)
+	if err != nil {
+		return err
+	}
+	if lock != nil && lock.UserID != userID {
+		return &LockedError{Lock: lock}
+	}
+	return nil
+}
+
+// accessible returns the file if the user owns it or holds an unexpired share of at least permission
+func (s *FileService) accessible(userID uint, id uuid.UUID, permission string) (*models.EncryptedFile, error) {
+	meta, err := s.Files.FindByID(id, userID)
+	if err == nil || !errors.Is(err, gorm.ErrRecordNotFound) || s.Grants == nil {
+		return meta, err
+	}
+	share, err := s.Grants.FindForGrantee(id, userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if share.File.ID == uuid.Nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	if permissionRank[share.Permission] < permissionRank[permission] {
+		return nil, ErrNotPermitted
+	}
+	return &share.File, nil
+}
+
+// writable returns the file if the user may change it: the owner or a user holding "edit"
+func (s *FileService) writable(userID uint, id uuid.UUID) (*models.EncryptedFile, error) {
+	return s.accessible(userID, id, models.PermissionEdit)
+}
+
+func (s *FileService) activeLock(fileID uuid.UUID) (*models.FileLock, error) {
+	lock, err := s.Files.FindLock(fileID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !lock.ExpiresAt.After(time.Now()) {
+		return nil, nil
+	}
+	return lock, nil
+}
+
+// Rename changes a file's display name. Stored blobs keep their names.
+func (s *FileService) Rename(userID uint, id uuid.UUID, filename string) (*models.EncryptedFile, error) {
+	filename = strings.TrimSpace(filename)
+	if filename == "" || len(filename) > 255 || strings.ContainsAny(filename, "/\\") {
+		return nil, errors.New("filename must be 1-255 chars without path separators")
+	}
+	meta, err := s.writable(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkLock(meta, userID); err != nil {
+		return nil, err
+	}
+	meta.Filename = filename
+	if err := s.Files.Update(meta, "Filename"); err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
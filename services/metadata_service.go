@@ -0,0 +1,248 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+
+	"file_project/config"
+	"file_project/models"
+
+	"github.com/google/uuid"
+)
+
+// Limits on file metadata
+const (
+	maxDescriptionLen   = 4096
+	maxProperties       = 50
+	maxPropertyKeyLen   = 64
+	maxPropertyValueLen = 1024
+)
+
+var ErrInvalidMetadata = errors.New("invalid metadata")
+
+var propertyKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// MetadataFilter narrows a file listing. Query matches the filename or description, ignoring case;
+// every entry in Properties must match a property of the file exactly.
+type MetadataFilter struct {
+	Query      string
+	Properties map[string]string
+}
+
+// fileMetadata is the plaintext sealed into EncryptedFile.Metadata
+type fileMetadata struct {
+	Description string            `json:"description,omitempty"`
+	Properties  models.Properties `json:"properties,omitempty"`
+}
+
+// GetMetadata returns the file with its description and properties decrypted
+func (s *FileService) GetMetadata(ownerID uint, id uuid.UUID) (*models.EncryptedFile, error) {
+	meta, err := s.Files.FindByID(id, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	if err := openMetadata(meta); err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
+
+// SetMetadata replaces the description and properties of a file
+func (s *FileService) SetMetadata(userID uint, id uuid.UUID, description string, props models.Properties) (*models.EncryptedFile, error) {
+	if err := validateMetadata(description, props); err != nil {
+		return nil, err
+	}
+	meta, err := s.writable(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkLock(meta, userID); err != nil {
+		return nil, err
+	}
+	sealed, err := sealMetadata(meta.ID, fileMetadata{Description: description, Properties: props})
+	if err != nil {
+		return nil, err
+	}
+	meta.Metadata = sealed
+	if err := s.Files.Update(meta, "Metadata"); err != nil {
+		return nil, err
+	}
+	meta.Description, meta.Properties = description, props
+	return meta, nil
+}
+
+// filterFiles decrypts the metadata of every file and keeps those matching f.
+// A file whose metadata cannot be opened (e.g. after METADATA_SECRET changed) is listed without it.
+func filterFiles(list []models.EncryptedFile, f MetadataFilter) []models.EncryptedFile {
+	out := list[:0]
+	for i := range list {
+		file := &list[i]
+		if err := openMetadata(file); err != nil {
+			log.Printf("metadata of file %s unreadable: %v", file.ID, err)
+		}
+		if f.matches(file) {
+			out = append(out, *file)
+		}
+	}
+	return out
+}
+
+func (f MetadataFilter) matches(file *models.EncryptedFile) bool {
+	for k, v := range f.Properties {
+		if got, ok := file.Properties[k]; !ok || got != v {
+			return false
+		}
+	}
+	if f.Query == "" {
+		return true
+	}
+	q := strings.ToLower(f.Query)
+	return strings.Contains(strings.ToLower(file.Filename), q) || strings.Contains(strings.ToLower(file.Description), q)
+}
+
+func validateMetadata(description string, props models.Properties) error {
+	if len(description) > maxDescriptionLen {
+		return fmt.Errorf("%w: description must be at most %d bytes", ErrInvalidMetadata, maxDescriptionLen)
+	}
+	if len(props) > maxProperties {
+		return fmt.Errorf("%w: at most %d properties per file", ErrInvalidMetadata, maxProperties)
+	}
+	for k, v := range props {
+		if len(k) > maxPropertyKeyLen || !propertyKeyPattern.MatchString(k) {
+			return fmt.Errorf("%w: property name %q must be 1-%d chars of letters, digits, '_', '.' or '-'", ErrInvalidMetadata, k, maxPropertyKeyLen)
+		}
+		if len(v) > maxPropertyValueLen {
+			return fmt.Errorf("%w: property %q must be at most %d bytes", ErrInvalidMetadata, k, maxPropertyValueLen)
+		}
+	}
+	return nil
+}
+
+// sealMetadata encrypts m with AES-GCM under the metadata key, bound to the file ID.
+// Empty metadata is stored as nil.
+func sealMetadata(fileID uuid.UUID, m fileMetadata) ([]byte, error) {
+	if m.Description == "" && len(m.Properties) == 0 {
+		return nil, nil
+	}
+	plain, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(metadataKey(config.C.MetadataSecret))
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, nonceSize)
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plain, fileID[:]), nil
+}
+
+// openMetadata decrypts file.Metadata into Description and Properties
+func openMetadata(file *models.EncryptedFile) error {
+	if len(file.Metadata) == 0 {
+		return nil
+	}
+	m, err := unsealMetadata(file.ID, file.Metadata, metadataKey(config.C.MetadataSecret))
+	if err != nil {
+		return err
+	}
+	file.Description, file.Properties = m.Description, m.Properties
+	return nil
+}
+
+func unsealMetadata(fileID uuid.UUID, sealed, key []byte) (fileMetadata, error) {
+	var m fileMetadata
+	if len(sealed) < nonceSize {
+		return m, errors.New("metadata truncated")
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return m, err
+	}
+	plain, err := gcm.Open(nil, sealed[:nonceSize], sealed[nonceSize:], fileID[:])
+	if err != nil {
+		return m, err
+	}
+	err = json.Unmarshal(plain, &m)
+	return m, err
+}
+
+func metadataKey(secret string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("file-metadata"))
+	return mac.Sum(nil)
+}
+
+// ResealMetadata moves metadata that was sealed under JWT_SECRET, back when METADATA_SECRET fell back to
+// it, to the current metadata key. Metadata that opens with neither key is left as it is.
+func (s *FileService) ResealMetadata() (int, error) {
+	list, err := s.Files.ListWithMetadata()
+	if err != nil {
+		return 0, err
+	}
+	current, legacy := metadataKey(config.C.MetadataSecret), metadataKey(config.C.JWTSecret)
+	n := 0
+	for i := range list {
+		f := &list[i]
+		if _, err := unsealMetadata(f.ID, f.Metadata, current); err == nil {
+			continue
+		}
+		m, err := unsealMetadata(f.ID, f.Metadata, legacy)
+		if err != nil {
+			continue
+		}
+		sealed, err := sealMetadata(f.ID, m)
+		if err != nil {
+			return n, err
+		}
+		ok, err := s.Files.ReplaceMetadata(f.ID, f.Metadata, sealed)
+		if err != nil {
+			return n, err
+		}
+		if ok {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// MetadataManifest builds a metadata.json archive entry describing every file in entries
+func (s *FileService) MetadataManifest(entries []ArchiveEntry) (ArchiveEntry, error) {
+	type item struct {
+		Path        string            `json:"path"`
+		ID          uuid.UUID         `json:"id"`
+		MimeType    string            `json:"mime_type"`
+		SHA256      string            `json:"sha256,omitempty"`
+		Description string            `json:"description,omitempty"`
+		Properties  models.Properties `json:"properties,omitempty"`
+	}
+	items := make([]item, 0, len(entries))
+	used := map[string]int{}
+	for _, e := range entries {
+		used[e.Name]++
+		if e.File == nil {
+			continue
+		}
+		if err := openMetadata(e.File); err != nil {
+			return ArchiveEntry{}, fmt.Errorf("%s: %w", e.Name, err)
+		}
+		items = append(items, item{Path: e.Name, ID: e.File.ID, MimeType: e.File.MimeType, SHA256: e.File.SHA256, Description: e.File.Description, Properties: e.File.Properties})
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Path < items[j].Path })
+	data, err := json.MarshalIndent(items, "", "  ")
+	if err != nil {
+		return ArchiveEntry{}, err
+	}
+	return ArchiveEntry{Name: uniqueName(used, "metadata.json"), Data: data}, nil
+}
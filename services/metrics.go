@@ -0,0 +1,14 @@
+package services
+
+import "expvar"
+
+// Process metrics, published through expvar at /debug/vars
+var (
+	metricScrubRuns     = expvar.NewInt("scrub_runs_total")
+	metricScrubChecked  = expvar.NewInt("scrub_blobs_checked_total")
+	metricScrubCorrupt  = expvar.NewInt("scrub_blobs_corrupt")
+	metricScrubMissing  = expvar.NewInt("scrub_blobs_missing")
+	metricScrubFailed   = expvar.NewInt("scrub_blobs_failed")
+	metricScrubLastRun  = expvar.NewInt("scrub_last_run_unix")
+	metricScrubDuration = expvar.NewFloat("scrub_last_duration_seconds")
+)
@@ -0,0 +1,331 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif" // register decoders for thumbnails
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"log"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"file_project/config"
+	"file_project/models"
+
+	"github.com/google/uuid"
+)
+
+// Preview kinds
+const (
+	PreviewThumb64  = "thumb_64"
+	PreviewThumb256 = "thumb_256"
+	PreviewThumb512 = "thumb_512"
+	PreviewText     = "text"
+)
+
+const (
+	maxPreviewSourceBytes = 32 << 20   // images larger than this are not thumbnailed
+	maxPreviewPixels      = 50_000_000 // guards against decompression bombs
+	maxPreviewTextBytes   = 8 << 10
+)
+
+var thumbnailSizes = []struct {
+	kind string
+	size int
+}{
+	{PreviewThumb64, 64},
+	{PreviewThumb256, 256},
+	{PreviewThumb512, 512},
+}
+
+var textPreviewTypes = map[string]bool{
+	"text/plain":       true,
+	"text/csv":         true,
+	"application/json": true,
+}
+
+// generatePreviews renders previews for version v from its plaintext and stores them encrypted under password.
+// Preview failures never fail the upload; they are logged and the file simply has no preview.
+func (s *FileService) generatePreviews(v *models.FileVersion, open func() (io.ReadCloser, error), password string) {
+	base, _, _ := mime.ParseMediaType(v.MimeType)
+	var rendered map[string][]byte
+	var err error
+	switch {
+	case strings.HasPrefix(base, "image/"):
+		if v.OriginalSize > maxPreviewSourceBytes {
+			return
+		}
+		rendered, err = renderThumbnails(open)
+	case textPreviewTypes[base]:
+		rendered, err = renderTextPreview(open, config.C.PreviewTextLines)
+	default:
+		return
+	}
+	if err != nil {
+		log.Printf("preview for %s v%d skipped: %v", v.FileID, v.Version, err)
+		return
+	}
+	for kind, data := range rendered {
+		mimeType := "image/jpeg"
+		if kind == PreviewText {
+			mimeType = "text/plain; charset=utf-8"
+		}
+		path := previewPath(v.FileID, v.Version, kind)
+		_, sum, err := s.encryptToFile(path, bytes.NewReader(data), password)
+		if err != nil {
+			log.Printf("preview for %s v%d not stored: %v", v.FileID, v.Version, err)
+			continue
+		}
+		now := time.Now()
+		p := &models.FilePreview{FileID: v.FileID, Version: v.Version, Kind: kind, MimeType: mimeType, Path: path, BlobSHA256: sum, Integrity: models.IntegrityOK, CheckedAt: &now}
+		if err := s.Previews.Create(p); err != nil {
+			s.destroyBlob(path)
+			log.Printf("preview for %s v%d not recorded: %v", v.FileID, v.Version, err)
+		}
+	}
+}
+
+// ListPreviews returns the previews available for the current version of a file
+func (s *FileService) ListPreviews(ownerID uint, id uuid.UUID) ([]models.FilePreview, error) {
+	meta, err := s.Files.FindByID(id, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	return s.Previews.ListByVersion(meta.ID, meta.Version)
+}
+
+// OpenPreview decrypts a preview of the current version of a file. The caller must close the reader.
+func (s *FileService) OpenPreview(ownerID uint, id uuid.UUID, kind, password string) (io.ReadCloser, *models.FilePreview, error) {
+	meta, err := s.Files.FindByID(id, ownerID)
+	if err != nil {
+		return nil, nil, err
+	}
+	p, err := s.Previews.Find(meta.ID, meta.Version, kind)
+	if err != nil {
+		return nil, nil, err
+	}
+	r, err := s.openBlob(p.Path, password)
+	if err != nil {
+		return nil, nil, err
+	}
+	return r, p, nil
+}
+
+// copyPreviews duplicates the previews of one version for another (used when restoring a version)
+func (s *FileService) copyPreviews(fileID uuid.UUID, from, to int) {
+	list, err := s.Previews.ListByVersion(fileID, from)
+	if err != nil {
+		return
+	}
+	for _, p := range list {
+		path := previewPath(fileID, to, p.Kind)
+		_, sum, err := s.copyBlob(p.Path, path)
+		if err != nil {
+			continue
+		}
+		now := time.Now()
+		cp := &models.FilePreview{FileID: fileID, Version: to, Kind: p.Kind, MimeType: p.MimeType, Path: path, BlobSHA256: sum, Integrity: models.IntegrityOK, CheckedAt: &now}
+		if err := s.Previews.Create(cp); err != nil {
+			s.destroyBlob(path)
+		}
+	}
+}
+
+// reencryptPreviews moves the previews of a version to a new password along with the version itself
+func (s *FileService) reencryptPreviews(fileID uuid.UUID, version int, oldPassword, newPassword string) error {
+	list, err := s.Previews.ListByVersion(fileID, version)
+	if err != nil {
+		return err
+	}
+	for _, p := range list {
+		if err := s.reencryptFile(p.Path, oldPassword, newPassword); err != nil {
+			return err
+		}
+		// a re-encrypted blob has new ciphertext; a rewrapped one keeps its checksum
+		sum, err := hashFile(p.Path)
+		if err != nil {
+			return err
+		}
+		if sum != p.BlobSHA256 {
+			if err := s.Previews.SetChecksum(p.ID, p.Path, sum, time.Now()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// removePreviews deletes preview blobs and rows of one version, or of all versions when version is 0,
+// and returns the weakest deletion guarantee that applied ("" when there were none)
+func (s *FileService) removePreviews(fileID uuid.UUID, version int) string {
+	var list []models.FilePreview
+	var err error
+	if version == 0 {
+		list, err = s.Previews.ListByFile(fileID)
+	} else {
+		list, err = s.Previews.ListByVersion(fileID, version)
+	}
+	if err != nil {
+		return ""
+	}
+	if version == 0 {
+		err = s.Previews.DeleteByFile(fileID)
+	} else {
+		err = s.Previews.DeleteByVersion(fileID, version)
+	}
+	if err != nil {
+		return ""
+	}
+	guarantee := ""
+	for _, p := range list {
+		guarantee = weakerDeletion(guarantee, s.destroyBlob(p.Path))
+	}
+	return guarantee
+}
+
+// reencryptFile moves an encrypted blob to a new password. Envelope blobs only have their data key
+// rewrapped; anything else is re-encrypted next to the old blob and swapped in.
+func (s *FileService) reencryptFile(path, oldPassword, newPassword string) error {
+	if ok, err := s.rewrapBlob(path, oldPassword, newPassword); ok || err != nil {
+		return err
+	}
+	r, err := s.openBlob(path, oldPassword)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	tmp := path + ".tmp"
+	if _, _, err := s.encryptToFile(tmp, r, newPassword); err != nil {
+		return err
+	}
+	s.destroyBlob(path)
+	if err := os.Rename(tmp, path); err != nil {
+		s.destroyBlob(tmp)
+		return err
+	}
+	return nil
+}
+
+func previewPath(id uuid.UUID, version int, kind string) string {
+	return filepath.Join("storage", fmt.Sprintf("%s_v%d_preview_%s.enc", id.String(), version, kind))
+}
+
+// renderThumbnails decodes an image and returns JPEG thumbnails that fit the configured square sizes
+func renderThumbnails(open func() (io.ReadCloser, error)) (map[string][]byte, error) {
+	src, err := open()
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+	br := bufio.NewReader(src)
+	head, _ := br.Peek(64 << 10)
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(head))
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Width*cfg.Height > maxPreviewPixels {
+		return nil, errors.New("image too large for preview")
+	}
+	img, _, err := image.Decode(br)
+	if err != nil {
+		return nil, err
+	}
+	// flatten onto white so transparent areas do not turn black in JPEG
+	b := img.Bounds()
+	flat := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(flat, flat.Bounds(), &image.Uniform{C: color.White}, image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Bounds(), img, b.Min, draw.Over)
+
+	out := make(map[string][]byte, len(thumbnailSizes))
+	for _, t := range thumbnailSizes {
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, scaleToFit(flat, t.size), &jpeg.Options{Quality: 80}); err != nil {
+			return nil, err
+		}
+		out[t.kind] = buf.Bytes()
+	}
+	return out, nil
+}
+
+// scaleToFit shrinks src with a box filter so that neither side exceeds max; it never upscales
+func scaleToFit(src *image.RGBA, max int) *image.RGBA {
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	dw, dh := sw, sh
+	if sw > max || sh > max {
+		if sw >= sh {
+			dw, dh = max, sh*max/sw
+		} else {
+			dw, dh = sw*max/sh, max
+		}
+	}
+	if dw < 1 {
+		dw = 1
+	}
+	if dh < 1 {
+		dh = 1
+	}
+	if dw == sw && dh == sh {
+		return src
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		y0, y1 := y*sh/dh, (y+1)*sh/dh
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < dw; x++ {
+			x0, x1 := x*sw/dw, (x+1)*sw/dw
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+			var r, g, bl, a, n uint32
+			for sy := y0; sy < y1; sy++ {
+				off := src.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					r += uint32(src.Pix[off])
+					g += uint32(src.Pix[off+1])
+					bl += uint32(src.Pix[off+2])
+					a += uint32(src.Pix[off+3])
+					off += 4
+					n++
+				}
+			}
+			d := dst.PixOffset(x, y)
+			dst.Pix[d], dst.Pix[d+1], dst.Pix[d+2], dst.Pix[d+3] = uint8(r/n), uint8(g/n), uint8(bl/n), uint8(a/n)
+		}
+	}
+	return dst
+}
+
+// renderTextPreview returns the first lines of a text file, capped at maxPreviewTextBytes
+func renderTextPreview(open func() (io.ReadCloser, error), lines int) (map[string][]byte, error) {
+	src, err := open()
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+	var buf bytes.Buffer
+	sc := bufio.NewScanner(io.LimitReader(src, maxPreviewTextBytes))
+	sc.Buffer(make([]byte, 0, 4096), maxPreviewTextBytes)
+	for i := 0; i < lines && sc.Scan(); i++ {
+		buf.Write(sc.Bytes())
+		buf.WriteByte('\n')
+	}
+	// the byte cap may cut a multi-byte character in half
+	data := buf.Bytes()
+	for len(data) > 0 && !utf8.Valid(data) {
+		data = data[:len(data)-1]
+	}
+	return map[string][]byte{PreviewText: data}, nil
+}
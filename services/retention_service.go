@@ -0,0 +1,126 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"file_project/models"
+	"file_project/repositories"
+
+	"github.com/google/uuid"
+)
+
+// RetentionService expires files according to their own expiry date, their folder's rule or their
+// owner's rule, in that order of precedence. Expired files go through the normal delete path, i.e. the
+// trash, so they stay restorable until the trash is purged. Folder and account rules count from the
+// upload, or from the last restore, so a restored file gets a full period again. Every automatic
+// deletion is audited.
+type RetentionService struct {
+	Files    *FileService
+	Policies repositories.RetentionRepository
+	Audit    repositories.AuditRepository
+}
+
+func NewRetentionService(files *FileService, policies repositories.RetentionRepository, audit repositories.AuditRepository) *RetentionService {
+	return &RetentionService{Files: files, Policies: policies, Audit: audit}
+}
+
+// GetPolicy returns the owner's retention policy
+func (s *RetentionService) GetPolicy(ownerID uint) (*models.RetentionPolicy, error) {
+	return s.Policies.GetPolicy(ownerID)
+}
+
+// SetPolicy stores the owner's retention policy (0 = keep forever)
+func (s *RetentionService) SetPolicy(ownerID uint, deleteAfterDays int) (*models.RetentionPolicy, error) {
+	if deleteAfterDays < 0 {
+		return nil, errors.New("delete_after_days must be >= 0")
+	}
+	p := &models.RetentionPolicy{UserID: ownerID, DeleteAfterDays: deleteAfterDays}
+	if err := s.Policies.SavePolicy(p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Run moves every expired file to the trash and returns how many were expired.
+// A file that cannot be deleted is logged and skipped so it does not hold up the others.
+func (s *RetentionService) Run() (int, error) {
+	now := time.Now()
+	n := 0
+	expire := func(list []models.EncryptedFile, reason string) {
+		for _, f := range list {
+			if err := s.expire(&f, reason); err != nil {
+				log.Printf("retention: %s not expired: %v", f.ID, err)
+				continue
+			}
+			n++
+		}
+	}
+
+	expired, err := s.Files.Files.ListExpired(now)
+	if err != nil {
+		return n, err
+	}
+	expire(expired, "expiry date reached")
+
+	folders, err := s.Policies.ListRetentionFolders()
+	if err != nil {
+		return n, err
+	}
+	for _, folder := range folders {
+		list, err := s.Files.Files.ListInFolderRetainedBefore(folder.ID, now.AddDate(0, 0, -folder.RetentionDays))
+		if err != nil {
+			return n, err
+		}
+		expire(list, fmt.Sprintf("folder %q retention of %d days", folder.Name, folder.RetentionDays))
+	}
+
+	policies, err := s.Policies.ListActivePolicies()
+	if err != nil {
+		return n, err
+	}
+	for _, p := range policies {
+		list, err := s.Files.Files.ListUnruledRetainedBefore(p.UserID, now.AddDate(0, 0, -p.DeleteAfterDays))
+		if err != nil {
+			return n, err
+		}
+		expire(list, fmt.Sprintf("account retention of %d days", p.DeleteAfterDays))
+	}
+	return n, nil
+}
+
+// expire deletes one file on behalf of the system and records why
+func (s *RetentionService) expire(f *models.EncryptedFile, reason string) error {
+	if err := s.Files.Delete(f.OwnerID, f.ID); err != nil {
+		return err
+	}
+	fileID := f.ID
+	entry := &models.AuditLog{
+		UserID: f.OwnerID,
+		Action: models.AuditFileExpired,
+		FileID: &fileID,
+		Detail: fmt.Sprintf("%s moved to trash: %s", f.Filename, reason),
+	}
+	if err := s.Audit.Create(entry); err != nil {
+		log.Printf("retention: audit record for %s not written: %v", f.ID, err)
+	}
+	return nil
+}
+
+// SetExpiry sets or clears (nil) the date at which a file is moved to the trash automatically
+func (s *FileService) SetExpiry(ownerID uint, id uuid.UUID, expiresAt *time.Time) (*models.EncryptedFile, error) {
+	meta, err := s.Files.FindByID(id, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return nil, errors.New("expires_at must be in the future")
+	}
+	meta.ExpiresAt = expiresAt
+	if err := s.Files.Update(meta, "ExpiresAt"); err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
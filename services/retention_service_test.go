@@ -0,0 +1,168 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"file_project/models"
+	"file_project/repositories"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// memFiles keeps files in memory and answers the queries the retention job and the trash use the
+// way the SQL in fileRepository does. Other methods are left to the embedded nil interface.
+type memFiles struct {
+	repositories.FileRepository
+	files map[uuid.UUID]*models.EncryptedFile
+	ruled map[uuid.UUID]bool // folders with a retention rule
+}
+
+func (m *memFiles) get(id uuid.UUID, ownerID uint, trashed bool) (*models.EncryptedFile, error) {
+	f, ok := m.files[id]
+	if !ok || f.OwnerID != ownerID || f.DeletedAt.Valid != trashed {
+		return nil, gorm.ErrRecordNotFound
+	}
+	cp := *f
+	return &cp, nil
+}
+
+func (m *memFiles) FindByID(id uuid.UUID, ownerID uint) (*models.EncryptedFile, error) {
+	return m.get(id, ownerID, false)
+}
+
+func (m *memFiles) FindTrashed(id uuid.UUID, ownerID uint) (*models.EncryptedFile, error) {
+	return m.get(id, ownerID, true)
+}
+
+func (m *memFiles) Delete(id uuid.UUID, ownerID uint) error {
+	m.files[id].DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+	return nil
+}
+
+func (m *memFiles) Restore(id uuid.UUID, ownerID uint) error {
+	now := time.Now()
+	m.files[id].DeletedAt = gorm.DeletedAt{}
+	m.files[id].RetentionFrom = &now
+	return nil
+}
+
+func (m *memFiles) FindLock(fileID uuid.UUID) (*models.FileLock, error) {
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (m *memFiles) ListExpired(now time.Time) ([]models.EncryptedFile, error) {
+	return nil, nil
+}
+
+func (m *memFiles) list(match func(f *models.EncryptedFile) bool, cutoff time.Time) []models.EncryptedFile {
+	var out []models.EncryptedFile
+	for _, f := range m.files {
+		start := f.CreatedAt
+		if f.RetentionFrom != nil {
+			start = *f.RetentionFrom
+		}
+		if !f.DeletedAt.Valid && f.ExpiresAt == nil && start.Before(cutoff) && match(f) {
+			out = append(out, *f)
+		}
+	}
+	return out
+}
+
+func (m *memFiles) ListInFolderRetainedBefore(folderID uuid.UUID, cutoff time.Time) ([]models.EncryptedFile, error) {
+	return m.list(func(f *models.EncryptedFile) bool { return f.FolderID != nil && *f.FolderID == folderID }, cutoff), nil
+}
+
+func (m *memFiles) ListUnruledRetainedBefore(ownerID uint, cutoff time.Time) ([]models.EncryptedFile, error) {
+	return m.list(func(f *models.EncryptedFile) bool {
+		return f.OwnerID == ownerID && (f.FolderID == nil || !m.ruled[*f.FolderID])
+	}, cutoff), nil
+}
+
+type memFolders struct {
+	repositories.FolderRepository
+	folders map[uuid.UUID]*models.Folder
+}
+
+func (m *memFolders) FindByID(id uuid.UUID, ownerID uint) (*models.Folder, error) {
+	f, ok := m.folders[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return f, nil
+}
+
+type memRetention struct {
+	repositories.RetentionRepository
+	folders  []models.Folder
+	policies []models.RetentionPolicy
+}
+
+func (m *memRetention) ListRetentionFolders() ([]models.Folder, error) {
+	return m.folders, nil
+}
+
+func (m *memRetention) ListActivePolicies() ([]models.RetentionPolicy, error) {
+	return m.policies, nil
+}
+
+type memAudit struct {
+	repositories.AuditRepository
+	entries []models.AuditLog
+}
+
+func (m *memAudit) Create(entry *models.AuditLog) error {
+	m.entries = append(m.entries, *entry)
+	return nil
+}
+
+func TestRetentionDoesNotRetrashRestoredFile(t *testing.T) {
+	const ownerID = 7
+	folder := models.Folder{ID: uuid.New(), OwnerID: ownerID, Name: "reports", RetentionDays: 30}
+
+	cases := []struct {
+		name     string
+		folderID *uuid.UUID
+		rules    *memRetention
+	}{
+		{"folder rule", &folder.ID, &memRetention{folders: []models.Folder{folder}}},
+		{"account rule", nil, &memRetention{policies: []models.RetentionPolicy{{UserID: ownerID, DeleteAfterDays: 30}}}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			file := &models.EncryptedFile{ID: uuid.New(), OwnerID: ownerID, FolderID: tc.folderID, Filename: "q1.pdf", CreatedAt: time.Now().AddDate(0, 0, -100)}
+			files := &memFiles{
+				files: map[uuid.UUID]*models.EncryptedFile{file.ID: file},
+				ruled: map[uuid.UUID]bool{folder.ID: true},
+			}
+			folders := &memFolders{folders: map[uuid.UUID]*models.Folder{folder.ID: &folder}}
+			fileSvc := NewFileService(files, nil, folders, nil, nil, nil)
+			audit := &memAudit{}
+			retention := NewRetentionService(fileSvc, tc.rules, audit)
+
+			if n, err := retention.Run(); err != nil || n != 1 {
+				t.Fatalf("first run expired %d files (err %v), want 1", n, err)
+			}
+			if err := fileSvc.Restore(ownerID, file.ID); err != nil {
+				t.Fatalf("restore: %v", err)
+			}
+			if n, err := retention.Run(); err != nil || n != 0 {
+				t.Fatalf("run after restore expired %d files (err %v), want 0", n, err)
+			}
+			if file.DeletedAt.Valid {
+				t.Fatal("restored file was moved to the trash again")
+			}
+
+			// the restore only restarts the clock: a full period later the rule applies again
+			restored := time.Now().AddDate(0, 0, -31)
+			file.RetentionFrom = &restored
+			if n, err := retention.Run(); err != nil || n != 1 {
+				t.Fatalf("run a period after the restore expired %d files (err %v), want 1", n, err)
+			}
+			if len(audit.entries) != 2 {
+				t.Fatalf("got %d audit entries, want 2", len(audit.entries))
+			}
+		})
+	}
+}
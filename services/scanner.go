@@ -0,0 +1,106 @@
+package services
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// ScanResult is the verdict of a malware scan
+type ScanResult struct {
+	Infected  bool
+	Signature string
+}
+
+// Scanner inspects plaintext before it is encrypted and stored
+type Scanner interface {
+	Scan(r io.Reader) (ScanResult, error)
+}
+
+const clamdChunkSize = 32 * 1024
+
+// ClamdScanner talks to a clamd daemon using the INSTREAM command
+type ClamdScanner struct {
+	Network string // "tcp" or "unix"
+	Address string // host:port or socket path
+	Timeout time.Duration
+}
+
+// NewClamdScanner parses an address of the form tcp://host:port or unix:///path/to/clamd.sock
+func NewClamdScanner(addr string, timeout time.Duration) (*ClamdScanner, error) {
+	switch {
+	case strings.HasPrefix(addr, "tcp://"):
+		return &ClamdScanner{Network: "tcp", Address: strings.TrimPrefix(addr, "tcp://"), Timeout: timeout}, nil
+	case strings.HasPrefix(addr, "unix://"):
+		return &ClamdScanner{Network: "unix", Address: strings.TrimPrefix(addr, "unix://"), Timeout: timeout}, nil
+	default:
+		return nil, fmt.Errorf("clamd address must start with tcp:// or unix://, got %q", addr)
+	}
+}
+
+// Scan streams r to clamd in length-prefixed chunks and parses the single-line reply
+func (s *ClamdScanner) Scan(r io.Reader) (ScanResult, error) {
+	conn, err := net.DialTimeout(s.Network, s.Address, s.Timeout)
+	if err != nil {
+		return ScanResult{}, err
+	}
+	defer conn.Close()
+	if s.Timeout > 0 {
+		_ = conn.SetDeadline(time.Now().Add(s.Timeout))
+	}
+
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return ScanResult{}, err
+	}
+	buf := make([]byte, clamdChunkSize)
+	size := make([]byte, 4)
+	for {
+		n, rerr := r.Read(buf)
+		if n > 0 {
+			binary.BigEndian.PutUint32(size, uint32(n))
+			if _, err := conn.Write(size); err != nil {
+				return ScanResult{}, err
+			}
+			if _, err := conn.Write(buf[:n]); err != nil {
+				return ScanResult{}, err
+			}
+		}
+		if rerr == io.EOF {
+			break
+		}
+		if rerr != nil {
+			return ScanResult{}, rerr
+		}
+	}
+	// a zero-length chunk ends the stream
+	if _, err := conn.Write([]byte{0, 0, 0, 0}); err != nil {
+		return ScanResult{}, err
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && err != io.EOF {
+		return ScanResult{}, err
+	}
+	return parseClamdReply(reply)
+}
+
+// parseClamdReply understands "stream: OK", "stream: <signature> FOUND" and "<message> ERROR"
+func parseClamdReply(reply string) (ScanResult, error) {
+	reply = strings.TrimRight(reply, "\x00\n")
+	reply = strings.TrimPrefix(reply, "stream: ")
+	switch {
+	case reply == "OK":
+		return ScanResult{}, nil
+	case strings.HasSuffix(reply, " FOUND"):
+		return ScanResult{Infected: true, Signature: strings.TrimSuffix(reply, " FOUND")}, nil
+	case strings.HasSuffix(reply, " ERROR"):
+		return ScanResult{}, errors.New("clamd: " + strings.TrimSuffix(reply, " ERROR"))
+	default:
+		return ScanResult{}, fmt.Errorf("clamd: unexpected reply %q", reply)
+	}
+}
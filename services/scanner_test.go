@@ -0,0 +1,157 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeClamd accepts one INSTREAM session on a local listener, collects the streamed bytes and answers
+// with reply. An empty reply keeps the connection open without answering until the client gives up.
+func fakeClamd(t *testing.T, reply string) (addr string, received <-chan []byte) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	got := make(chan []byte, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		cmd, err := r.ReadString(0)
+		if err != nil || cmd != "zINSTREAM\x00" {
+			return
+		}
+		var data bytes.Buffer
+		size := make([]byte, 4)
+		for {
+			if _, err := io.ReadFull(r, size); err != nil {
+				return
+			}
+			n := binary.BigEndian.Uint32(size)
+			if n == 0 {
+				break
+			}
+			if _, err := io.CopyN(&data, r, int64(n)); err != nil {
+				return
+			}
+		}
+		got <- data.Bytes()
+		if reply == "" {
+			// wait for the client to time out and hang up
+			_, _ = io.Copy(io.Discard, r)
+			return
+		}
+		_, _ = conn.Write([]byte(reply + "\x00"))
+	}()
+	return ln.Addr().String(), got
+}
+
+func TestClamdScannerScan(t *testing.T) {
+	cases := []struct {
+		name      string
+		reply     string
+		want      ScanResult
+		wantErr   string
+		isTimeout bool
+	}{
+		{name: "clean", reply: "stream: OK", want: ScanResult{}},
+		{name: "infected", reply: "stream: Eicar-Test-Signature FOUND", want: ScanResult{Infected: true, Signature: "Eicar-Test-Signature"}},
+		{name: "error", reply: "INSTREAM size limit exceeded. ERROR", wantErr: "clamd: INSTREAM size limit exceeded."},
+		{name: "timeout", reply: "", isTimeout: true},
+	}
+	// more than one chunk, so the length-prefixed framing is exercised
+	payload := bytes.Repeat([]byte("0123456789abcdef"), clamdChunkSize/8)
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			addr, received := fakeClamd(t, tc.reply)
+			scanner, err := NewClamdScanner("tcp://"+addr, 300*time.Millisecond)
+			if err != nil {
+				t.Fatalf("NewClamdScanner: %v", err)
+			}
+			res, err := scanner.Scan(bytes.NewReader(payload))
+
+			select {
+			case data := <-received:
+				if !bytes.Equal(data, payload) {
+					t.Errorf("clamd received %d bytes, want %d", len(data), len(payload))
+				}
+			case <-time.After(time.Second):
+				t.Fatal("clamd never received the end of the stream")
+			}
+
+			switch {
+			case tc.isTimeout:
+				var ne net.Error
+				if !errors.As(err, &ne) || !ne.Timeout() {
+					t.Fatalf("got error %v, want a timeout", err)
+				}
+			case tc.wantErr != "":
+				if err == nil || err.Error() != tc.wantErr {
+					t.Fatalf("got error %v, want %q", err, tc.wantErr)
+				}
+			default:
+				if err != nil {
+					t.Fatalf("Scan: %v", err)
+				}
+				if res != tc.want {
+					t.Fatalf("got %+v, want %+v", res, tc.want)
+				}
+			}
+		})
+	}
+}
+
+func TestClamdScannerUnreachable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	scanner, err := NewClamdScanner("tcp://"+addr, 300*time.Millisecond)
+	if err != nil {
+		t.Fatalf("NewClamdScanner: %v", err)
+	}
+	if _, err := scanner.Scan(strings.NewReader("data")); err == nil {
+		t.Fatal("scan against a closed port succeeded")
+	}
+}
+
+func TestParseClamdReply(t *testing.T) {
+	cases := []struct {
+		reply   string
+		want    ScanResult
+		wantErr bool
+	}{
+		{reply: "stream: OK\x00", want: ScanResult{}},
+		{reply: "stream: OK\n", want: ScanResult{}},
+		{reply: "stream: Win.Test.EICAR_HDB-1 FOUND\x00", want: ScanResult{Infected: true, Signature: "Win.Test.EICAR_HDB-1"}},
+		{reply: "Can't allocate memory ERROR\x00", wantErr: true},
+		{reply: "", wantErr: true},
+		{reply: "stream: SOMETHING ELSE", wantErr: true},
+	}
+	for _, tc := range cases {
+		got, err := parseClamdReply(tc.reply)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("parseClamdReply(%q) error = %v, want error %v", tc.reply, err, tc.wantErr)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("parseClamdReply(%q) = %+v, want %+v", tc.reply, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package services
+
+import (
+	"log"
+	"time"
+)
+
+// RunEvery starts a background goroutine that calls fn on a fixed interval.
+// Errors are logged and do not stop the schedule. A non-positive interval disables the job.
+func RunEvery(name string, interval time.Duration, fn func() error) {
+	if interval <= 0 {
+		log.Printf("job %s disabled", name)
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := fn(); err != nil {
+				log.Printf("job %s failed: %v", name, err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,266 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"file_project/models"
+	"file_project/repositories"
+
+	"github.com/google/uuid"
+)
+
+const scrubPageSize = 200
+
+var ErrScrubRunning = errors.New("scrub already running")
+
+// ScrubReport summarises one pass of the integrity scrubber
+type ScrubReport struct {
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Checked    int       `json:"checked"`
+	OK         int       `json:"ok"`
+	Recorded   int       `json:"recorded"` // blobs that had no checksum yet and got one
+	Corrupt    int       `json:"corrupt"`
+	Missing    int       `json:"missing"`
+	Failed     int       `json:"failed"` // blobs that could not be read; they keep their previous state
+}
+
+// ScrubService re-hashes every stored blob (file versions and their previews) and compares it with the
+// checksum recorded at write time. This detects bit rot and tampering without needing any file password.
+type ScrubService struct {
+	Versions repositories.FileVersionRepository
+	Previews repositories.FilePreviewRepository
+
+	mu      sync.Mutex
+	running bool
+	last    *ScrubReport
+}
+
+func NewScrubService(versions repositories.FileVersionRepository, previews repositories.FilePreviewRepository) *ScrubService {
+	return &ScrubService{Versions: versions, Previews: previews}
+}
+
+// scrubBlob is the part of a version or preview row the scrubber works with
+type scrubBlob struct {
+	ID       uuid.UUID
+	Path     string
+	Checksum string
+}
+
+// scrubTable gives the scrubber access to one kind of blob-backed row
+type scrubTable struct {
+	name   string
+	page   func(after uuid.UUID) ([]scrubBlob, error)
+	reload func(id uuid.UUID) (scrubBlob, error)
+	record func(b scrubBlob, status string, at time.Time) (bool, error)
+}
+
+func (s *ScrubService) tables() []scrubTable {
+	return []scrubTable{
+		{
+			name: "version",
+			page: func(after uuid.UUID) ([]scrubBlob, error) {
+				list, err := s.Versions.ListPage(after, scrubPageSize)
+				out := make([]scrubBlob, len(list))
+				for i, v := range list {
+					out[i] = scrubBlob{v.ID, v.Path, v.BlobSHA256}
+				}
+				return out, err
+			},
+			reload: func(id uuid.UUID) (scrubBlob, error) {
+				v, err := s.Versions.FindByID(id)
+				if err != nil {
+					return scrubBlob{}, err
+				}
+				return scrubBlob{v.ID, v.Path, v.BlobSHA256}, nil
+			},
+			record: func(b scrubBlob, status string, at time.Time) (bool, error) {
+				return s.Versions.SetIntegrity(b.ID, b.Path, b.Checksum, status, at)
+			},
+		},
+		{
+			name: "preview",
+			page: func(after uuid.UUID) ([]scrubBlob, error) {
+				list, err := s.Previews.ListPage(after, scrubPageSize)
+				out := make([]scrubBlob, len(list))
+				for i, p := range list {
+					out[i] = scrubBlob{p.ID, p.Path, p.BlobSHA256}
+				}
+				return out, err
+			},
+			reload: func(id uuid.UUID) (scrubBlob, error) {
+				p, err := s.Previews.FindByID(id)
+				if err != nil {
+					return scrubBlob{}, err
+				}
+				return scrubBlob{p.ID, p.Path, p.BlobSHA256}, nil
+			},
+			record: func(b scrubBlob, status string, at time.Time) (bool, error) {
+				return s.Previews.SetIntegrity(b.ID, b.Path, b.Checksum, status, at)
+			},
+		},
+	}
+}
+
+// Run performs a full scrub pass; only one pass runs at a time
+func (s *ScrubService) Run() (*ScrubReport, error) {
+	s.mu.Lock()
+	if s.running {
+		s.mu.Unlock()
+		return nil, ErrScrubRunning
+	}
+	s.running = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.running = false
+		s.mu.Unlock()
+	}()
+
+	report := &ScrubReport{StartedAt: time.Now()}
+	for _, t := range s.tables() {
+		after := uuid.Nil
+		for {
+			page, err := t.page(after)
+			if err != nil {
+				return nil, err
+			}
+			if len(page) == 0 {
+				break
+			}
+			for _, b := range page {
+				if err := s.check(t, b, report); err != nil {
+					return nil, err
+				}
+			}
+			after = page[len(page)-1].ID
+		}
+	}
+	report.FinishedAt = time.Now()
+
+	metricScrubRuns.Add(1)
+	metricScrubChecked.Add(int64(report.Checked))
+	metricScrubCorrupt.Set(int64(report.Corrupt))
+	metricScrubMissing.Set(int64(report.Missing))
+	metricScrubFailed.Set(int64(report.Failed))
+	metricScrubLastRun.Set(report.FinishedAt.Unix())
+	metricScrubDuration.Set(report.FinishedAt.Sub(report.StartedAt).Seconds())
+
+	s.mu.Lock()
+	s.last = report
+	s.mu.Unlock()
+	if report.Corrupt > 0 || report.Missing > 0 || report.Failed > 0 {
+		log.Printf("scrub: %d corrupt, %d missing and %d unreadable blobs", report.Corrupt, report.Missing, report.Failed)
+	}
+	return report, nil
+}
+
+// check verifies one blob and stores the outcome. Only the integrity columns are written, and only
+// if the row still points at the blob that was checked. A blob that cannot be read is counted as
+// failed and left as it is; only database errors end the pass.
+func (s *ScrubService) check(t scrubTable, b scrubBlob, report *ScrubReport) error {
+	report.Checked++
+	sum, err := hashFile(b.Path)
+	if err != nil || (b.Checksum != "" && b.Checksum != sum) {
+		// the blob may have been rewritten or replaced (password change, purge) after this page was loaded
+		fresh, ferr := t.reload(b.ID)
+		if ferr != nil {
+			return nil
+		}
+		b = fresh
+		sum, err = hashFile(b.Path)
+	}
+	status := models.IntegrityOK
+	recorded := false
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		status = models.IntegrityMissing
+	case err != nil:
+		log.Printf("scrub: %s %s unreadable: %v", t.name, b.ID, err)
+		report.Failed++
+		return nil
+	case b.Checksum == "":
+		// written before checksums existed: trust the blob as it is now and watch it from here on
+		b.Checksum = sum
+		recorded = true
+	case b.Checksum != sum:
+		status = models.IntegrityCorrupt
+	}
+	ok, err := t.record(b, status, time.Now())
+	if err != nil || !ok {
+		// changed under us: the next pass checks the new blob
+		return err
+	}
+	switch status {
+	case models.IntegrityOK:
+		report.OK++
+		if recorded {
+			report.Recorded++
+		}
+	case models.IntegrityCorrupt:
+		report.Corrupt++
+	case models.IntegrityMissing:
+		report.Missing++
+	}
+	return nil
+}
+
+// Running reports whether a scrub pass is in progress
+func (s *ScrubService) Running() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.running
+}
+
+// LastReport returns the result of the most recent completed pass, if any
+func (s *ScrubService) LastReport() *ScrubReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.last
+}
+
+// Flagged returns all version blobs currently marked corrupt or missing
+func (s *ScrubService) Flagged() ([]models.FileVersion, error) {
+	return s.Versions.ListByIntegrity([]string{models.IntegrityCorrupt, models.IntegrityMissing})
+}
+
+// FlaggedPreviews returns all preview blobs currently marked corrupt or missing
+func (s *ScrubService) FlaggedPreviews() ([]models.FilePreview, error) {
+	return s.Previews.ListByIntegrity([]string{models.IntegrityCorrupt, models.IntegrityMissing})
+}
+
+// Counts returns the number of blobs, versions and previews together, in each integrity state
+func (s *ScrubService) Counts() (map[string]int64, error) {
+	counts, err := s.Versions.CountByIntegrity()
+	if err != nil {
+		return nil, err
+	}
+	previews, err := s.Previews.CountByIntegrity()
+	if err != nil {
+		return nil, err
+	}
+	for state, n := range previews {
+		counts[state] += n
+	}
+	return counts, nil
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
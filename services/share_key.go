@@ -0,0 +1,126 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+
+	"file_project/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ErrNoDataKey is returned when a link secret is requested for a blob written before per-file data keys
+var ErrNoDataKey = errors.New("this version predates per-file data keys; change the file password once to upgrade it")
+
+// ErrShareKeyStale is returned when the version a link points at was re-encrypted under a new data key
+var ErrShareKeyStale = errors.New("the shared version was re-encrypted; create a new link")
+
+// ShareKey is a copy of a version's data key wrapped under a share link's own secret
+type ShareKey struct {
+	Version int
+	KeyID   uuid.UUID
+	Salt    []byte
+	Wrapped []byte
+	InURL   bool // the secret is a random key carried in the link's URL fragment
+}
+
+// ShareKey unwraps the data key of a version with the file password and wraps a copy under secret.
+// A nil version means the current one.
+func (s *FileService) ShareKey(ownerID uint, id uuid.UUID, version *int, password, secret string) (*ShareKey, error) {
+	meta, err := s.Shareable(ownerID, id)
+	if err != nil {
+		return nil, err
+	}
+	n := meta.Version
+	if version != nil {
+		n = *version
+	}
+	v, err := s.Versions.FindByVersion(meta.ID, n)
+	if err != nil {
+		return nil, err
+	}
+	keyID, ok := blobKeyID(v.Path)
+	if !ok {
+		return nil, ErrNoDataKey
+	}
+	dk, err := s.Keys.FindByID(keyID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrShredded
+	}
+	if err != nil {
+		return nil, err
+	}
+	key, err := unwrapDataKey(dk, password)
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := wrapDataKey(keyID, key, secret)
+	if err != nil {
+		return nil, err
+	}
+	return &ShareKey{Version: n, KeyID: keyID, Salt: wrapped.Salt, Wrapped: wrapped.Wrapped}, nil
+}
+
+// OpenShared opens the version a link with its own secret points at, using the link's copy of the
+// data key. The owner's password is not involved. The caller must close the reader.
+func (s *FileService) OpenShared(l *models.ShareLink, secret string) (io.ReadCloser, *models.EncryptedFile, *models.FileVersion, error) {
+	if l.KeyID == nil || l.Version == nil || l.FileID == nil {
+		return nil, nil, nil, ErrWrongPassword
+	}
+	meta, err := s.Files.FindByID(*l.FileID, l.CreatedByUser)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return s.openKeyCopy(meta, *l.Version, *l.KeyID, l.KeySalt, l.WrappedKey, secret)
+}
+
+// openKeyCopy opens a version of meta with a copy of its data key wrapped under secret
+func (s *FileService) openKeyCopy(meta *models.EncryptedFile, version int, keyID uuid.UUID, salt, wrapped []byte, secret string) (io.ReadCloser, *models.EncryptedFile, *models.FileVersion, error) {
+	v, err := s.Versions.FindByVersion(meta.ID, version)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if meta.ScanStatus == models.ScanInfected || v.ScanStatus == models.ScanInfected {
+		return nil, nil, nil, ErrQuarantined
+	}
+	// the copy is only honoured while the blob's own key exists, so crypto-shredding still holds
+	if _, err := s.Keys.FindByID(keyID); errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, nil, ErrShredded
+	} else if err != nil {
+		return nil, nil, nil, err
+	}
+	key, err := unwrapDataKey(&models.DataKey{ID: keyID, Salt: salt, Wrapped: wrapped}, secret)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	r, err := openBlobWithKey(v.Path, keyID, key)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return r, meta, v, nil
+}
+
+// openBlobWithKey opens an envelope blob with an already unwrapped data key
+func openBlobWithKey(path string, keyID uuid.UUID, key []byte) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	br := bufio.NewReaderSize(f, streamSealedChunk+1)
+	header := make([]byte, envelopeHeaderSize)
+	if _, err := io.ReadFull(br, header); err != nil || string(header[:len(envelopeMagic)]) != envelopeMagic ||
+		!bytes.Equal(header[len(envelopeMagic):len(envelopeMagic)+envelopeKeyIDSize], keyID[:]) {
+		f.Close()
+		return nil, ErrShareKeyStale
+	}
+	r, err := openStream(br, header, key)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &blobReader{Reader: r, closer: f}, nil
+}
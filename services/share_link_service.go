@@ -2,26 +2,71 @@ package services
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"errors"
+	"log"
 	"time"
 
 	"file_project/models"
 	"file_project/repositories"
 
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
+// Share link states reported to their owner
+const (
+	ShareActive      = "active"
+	ShareDisabled    = "disabled"
+	ShareScheduled   = "scheduled" // not_before is still in the future
+	ShareExpired     = "expired"
+	ShareExhausted   = "exhausted"   // download limit reached
+	ShareUnavailable = "unavailable" // file trashed or quarantined, or folder deleted
+)
+
+// ShareLinkUsage is a share link with its usage, as listed to the user who created it
+type ShareLinkUsage struct {
+	models.ShareLink
+	Filename           string `json:"filename,omitempty"`
+	FolderName         string `json:"folder_name,omitempty"`
+	RemainingDownloads *int   `json:"remaining_downloads,omitempty"`
+	Status             string `json:"status"`
+}
+
+// ShareUpdate changes the limits of an existing link. Fields left unset keep their value;
+// a set field with a nil value removes the limit.
+type ShareUpdate struct {
+	SetExpiresAt    bool
+	ExpiresAt       *time.Time
+	SetMaxDownloads bool
+	MaxDownloads    *int
+	Disabled        *bool
+	HideFilename    *bool
+	Restrictions    *models.ShareRestrictions // replaces all restrictions
+}
+
+// maxUserAgentLen is how much of a user agent the access log keeps
+const maxUserAgentLen = 512
+
 type ShareLinkService struct {
-	Links repositories.ShareLinkRepository
+	Links    repositories.ShareLinkRepository
+	Accesses repositories.ShareAccessRepository
 }
 
-func NewShareLinkService(links repositories.ShareLinkRepository) *ShareLinkService {
-	return &ShareLinkService{Links: links}
+func NewShareLinkService(links repositories.ShareLinkRepository, accesses repositories.ShareAccessRepository) *ShareLinkService {
+	return &ShareLinkService{Links: links, Accesses: accesses}
 }
 
-// CreateShareLink creates a share token for a file owned by the user with optional expiry/max-download limit
-func (s *ShareLinkService) CreateShareLink(fileID uuid.UUID, createdBy uint, expiresInMinutes *int, maxDownloads *int) (*models.ShareLink, error) {
+// CreateShareLink creates a share token for a file owned by the user with optional expiry/max-download limit.
+// A non-nil version pins the link to that revision; otherwise it always serves the latest one.
+// With a key the link is opened by its own secret instead of the file password and is pinned to
+// the version the key belongs to.
+func (s *ShareLinkService) CreateShareLink(fileID uuid.UUID, createdBy uint, expiresInMinutes *int, maxDownloads *int, version *int, key *ShareKey, restrictions models.ShareRestrictions, hideFilename bool) (*models.ShareLink, error) {
+	if err := normalizeRestrictions(&restrictions); err != nil {
+		return nil, err
+	}
 	token, err := generateToken(32)
 	if err != nil {
 		return nil, err
@@ -32,41 +77,314 @@ func (s *ShareLinkService) CreateShareLink(fileID uuid.UUID, createdBy uint, exp
 		expiresAt = &t
 	}
 	link := &models.ShareLink{
-		Token:         token,
-		FileID:        fileID,
+		TokenHash:     hashToken(token),
+		FileID:        &fileID,
 		ExpiresAt:     expiresAt,
 		MaxDownloads:  maxDownloads,
+		Version:       version,
 		Downloads:     0,
+		HideFilename:  hideFilename,
+		CreatedByUser: createdBy,
+		Protection:    models.ProtectFilePassword,
+		Restrictions:  restrictions,
+	}
+	if key != nil {
+		v := key.Version
+		link.Version, link.KeyID, link.KeySalt, link.WrappedKey = &v, &key.KeyID, key.Salt, key.Wrapped
+		link.Protection = models.ProtectSharePassword
+		if key.InURL {
+			link.Protection = models.ProtectURLKey
+		}
+	}
+	if err := s.Links.Create(link); err != nil {
+		return nil, err
+	}
+	link.Token = token
+	return link, nil
+}
+
+// CreateFolderLink creates a share token for a folder owned by the user. The link serves the folder's
+// files and sub-folders as they are when it is used, each file opened with its own password.
+func (s *ShareLinkService) CreateFolderLink(folderID uuid.UUID, createdBy uint, expiresInMinutes *int, maxDownloads *int, restrictions models.ShareRestrictions, hideFilename bool) (*models.ShareLink, error) {
+	if err := normalizeRestrictions(&restrictions); err != nil {
+		return nil, err
+	}
+	token, err := generateToken(32)
+	if err != nil {
+		return nil, err
+	}
+	var expiresAt *time.Time
+	if expiresInMinutes != nil && *expiresInMinutes > 0 {
+		t := time.Now().Add(time.Duration(*expiresInMinutes) * time.Minute)
+		expiresAt = &t
+	}
+	link := &models.ShareLink{
+		TokenHash:     hashToken(token),
+		FolderID:      &folderID,
+		ExpiresAt:     expiresAt,
+		MaxDownloads:  maxDownloads,
+		HideFilename:  hideFilename,
 		CreatedByUser: createdBy,
+		Protection:    models.ProtectFilePassword,
+		Restrictions:  restrictions,
 	}
 	if err := s.Links.Create(link); err != nil {
 		return nil, err
 	}
+	link.Token = token
 	return link, nil
 }
 
-// ValidateAndRecord checks limits and increments download counter
-func (s *ShareLinkService) ValidateAndRecord(token string) (*models.ShareLink, error) {
-	l, err := s.Links.FindByToken(token)
+// FindByToken looks a link up by the hash of its token. Only the hash reaches the database, so the
+// lookup reveals nothing about the token itself.
+func (s *ShareLinkService) FindByToken(token string) (*models.ShareLink, error) {
+	return s.Links.FindByTokenHash(hashToken(token))
+}
+
+// Check verifies a link and its restrictions against req without counting a download; folder links
+// use it for their listing. Refusals are returned as *ShareDenied with a reason and, once the link
+// is known, recorded in its access log.
+func (s *ShareLinkService) Check(token string, req AccessRequest) (*models.ShareLink, error) {
+	l, err := s.FindByToken(token)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, denied(DenyNotFound, "link not found")
+	}
 	if err != nil {
 		return nil, err
 	}
+	if d := verifyLink(l, req); d != nil {
+		s.Record(l, req, l.FileID, models.AccessDenied, d.Reason, 0)
+		return nil, d
+	}
+	return l, nil
+}
+
+// verifyLink checks a link's target, state and restrictions
+func verifyLink(l *models.ShareLink, req AccessRequest) *ShareDenied {
+	if l.FolderID != nil {
+		if l.Folder.ID == uuid.Nil {
+			return denied(DenyUnavailable, "folder not available")
+		}
+		// a link minted for a folder its creator does not own is never honoured
+		if l.Folder.OwnerID != l.CreatedByUser {
+			return denied(DenyInvalid, "link not valid")
+		}
+	} else {
+		// the file was trashed (soft-deleted rows are not preloaded)
+		if l.File.ID == uuid.Nil {
+			return denied(DenyUnavailable, "file not available")
+		}
+		if l.File.ScanStatus == models.ScanInfected {
+			return denied(DenyQuarantined, "file is quarantined")
+		}
+		// a link minted for a file its creator does not own is never honoured
+		if l.File.OwnerID != l.CreatedByUser {
+			return denied(DenyInvalid, "link not valid")
+		}
+	}
+	if l.Disabled {
+		return denied(DenyDisabled, "link disabled")
+	}
 	// expiry
-	if l.ExpiresAt != nil && time.Now().After(*l.ExpiresAt) {
-		return nil, errors.New("link expired")
+	if l.ExpiresAt != nil && req.Now.After(*l.ExpiresAt) {
+		return denied(DenyExpired, "link expired")
+	}
+	return checkRestrictions(l.Restrictions, req)
+}
+
+// Claim checks a link like Check and atomically counts one download against its limit.
+// The claim must be given back with Release if the download does not complete.
+func (s *ShareLinkService) Claim(token string, req AccessRequest) (*models.ShareLink, error) {
+	l, err := s.Check(token, req)
+	if err != nil {
+		return nil, err
+	}
+	// max downloads, enforced by the conditional update
+	claimed, err := s.Links.Claim(l.ID, req.Now)
+	if err != nil {
+		return nil, err
+	}
+	if claimed == nil {
+		s.Record(l, req, l.FileID, models.AccessDenied, DenyLimitReached, 0)
+		return nil, denied(DenyLimitReached, "download limit reached")
+	}
+	claimed.File, claimed.Folder = l.File, l.Folder
+	return claimed, nil
+}
+
+// Release gives back a claimed download that failed or was aborted
+func (s *ShareLinkService) Release(id uuid.UUID) {
+	if err := s.Links.Unclaim(id); err != nil {
+		log.Printf("share %s: releasing download claim failed: %v", id, err)
+	}
+}
+
+// Record adds one access to a link's log; the request never fails because logging did.
+// The duration is measured from req.Now.
+func (s *ShareLinkService) Record(l *models.ShareLink, req AccessRequest, fileID *uuid.UUID, outcome, reason string, bytesSent int64) {
+	ua := req.UserAgent
+	if len(ua) > maxUserAgentLen {
+		ua = ua[:maxUserAgentLen]
+	}
+	a := &models.ShareAccess{
+		LinkID:     l.ID,
+		FileID:     fileID,
+		Action:     req.Action,
+		Outcome:    outcome,
+		Reason:     reason,
+		IP:         req.IP,
+		UserAgent:  ua,
+		BytesSent:  bytesSent,
+		StartedAt:  req.Now,
+		DurationMs: time.Since(req.Now).Milliseconds(),
+	}
+	if err := s.Accesses.Create(a); err != nil {
+		log.Printf("share %s: recording access failed: %v", l.ID, err)
 	}
-	// max downloads
-	if l.MaxDownloads != nil && l.Downloads >= *l.MaxDownloads {
-		return nil, errors.New("download limit reached")
+}
+
+// ListAccesses returns the latest accesses of a link created by the user, newest first
+func (s *ShareLinkService) ListAccesses(id uuid.UUID, createdBy uint, limit int) ([]models.ShareAccess, error) {
+	if _, err := s.owned(id, createdBy); err != nil {
+		return nil, err
 	}
-	if err := s.Links.IncrementDownload(token); err != nil {
+	return s.Accesses.ListByLink(id, limit)
+}
+
+// Stats summarizes the accesses of a link created by the user
+func (s *ShareLinkService) Stats(id uuid.UUID, createdBy uint) (*models.ShareAccessStats, error) {
+	if _, err := s.owned(id, createdBy); err != nil {
 		return nil, err
 	}
+	return s.Accesses.StatsByLink(id)
+}
+
+// FileStats summarizes every access that served a file, across all its links, revoked ones
+// included. The caller checks that the file belongs to the user.
+func (s *ShareLinkService) FileStats(fileID uuid.UUID) (*models.ShareAccessStats, error) {
+	return s.Accesses.StatsByFile(fileID)
+}
+
+// PruneAccesses deletes access records older than maxAge
+func (s *ShareLinkService) PruneAccesses(maxAge time.Duration) (int64, error) {
+	return s.Accesses.DeleteBefore(time.Now().Add(-maxAge))
+}
+
+// owned returns a link if the user created it
+func (s *ShareLinkService) owned(id uuid.UUID, createdBy uint) (*models.ShareLink, error) {
+	l, err := s.Links.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if l.CreatedByUser != createdBy {
+		return nil, gorm.ErrRecordNotFound
+	}
 	return l, nil
 }
 
-func (s *ShareLinkService) Delete(token string, createdBy uint) error {
-	return s.Links.Delete(token, createdBy)
+func (s *ShareLinkService) Delete(id uuid.UUID, createdBy uint) error {
+	return s.Links.Delete(id, createdBy)
+}
+
+// List returns every link the user created with its usage
+func (s *ShareLinkService) List(createdBy uint) ([]ShareLinkUsage, error) {
+	links, err := s.Links.ListByCreator(createdBy)
+	if err != nil {
+		return nil, err
+	}
+	return usageOf(links), nil
+}
+
+// ListForFile returns the user's links to one file with their usage
+func (s *ShareLinkService) ListForFile(fileID uuid.UUID, createdBy uint) ([]ShareLinkUsage, error) {
+	links, err := s.Links.ListByFile(fileID, createdBy)
+	if err != nil {
+		return nil, err
+	}
+	return usageOf(links), nil
+}
+
+// Update applies u to a link created by the user
+func (s *ShareLinkService) Update(id uuid.UUID, createdBy uint, u ShareUpdate) (*ShareLinkUsage, error) {
+	l, err := s.owned(id, createdBy)
+	if err != nil {
+		return nil, err
+	}
+	if u.SetExpiresAt {
+		l.ExpiresAt = u.ExpiresAt
+	}
+	if u.SetMaxDownloads {
+		l.MaxDownloads = u.MaxDownloads
+	}
+	if u.Disabled != nil {
+		l.Disabled = *u.Disabled
+	}
+	if u.HideFilename != nil {
+		l.HideFilename = *u.HideFilename
+	}
+	if u.Restrictions != nil {
+		if err := normalizeRestrictions(u.Restrictions); err != nil {
+			return nil, err
+		}
+		l.Restrictions = *u.Restrictions
+	}
+	if err := s.Links.Update(l); err != nil {
+		return nil, err
+	}
+	usage := usageOf([]models.ShareLink{*l})[0]
+	return &usage, nil
+}
+
+// RevokeAll deletes every link the user created for a file and returns how many there were
+func (s *ShareLinkService) RevokeAll(fileID uuid.UUID, createdBy uint) (int64, error) {
+	return s.Links.DeleteByFile(fileID, createdBy)
+}
+
+func usageOf(links []models.ShareLink) []ShareLinkUsage {
+	now := time.Now()
+	out := make([]ShareLinkUsage, 0, len(links))
+	for _, l := range links {
+		u := ShareLinkUsage{ShareLink: l, Filename: l.File.Filename, FolderName: l.Folder.Name, RemainingDownloads: RemainingDownloads(&l), Status: ShareActive}
+		switch {
+		case l.FolderID != nil && l.Folder.ID == uuid.Nil:
+			u.Status = ShareUnavailable
+		case l.FolderID == nil && (l.File.ID == uuid.Nil || l.File.ScanStatus == models.ScanInfected):
+			u.Status = ShareUnavailable
+		case l.Disabled:
+			u.Status = ShareDisabled
+		case l.Restrictions.NotBefore != nil && now.Before(*l.Restrictions.NotBefore):
+			u.Status = ShareScheduled
+		case l.ExpiresAt != nil && now.After(*l.ExpiresAt):
+			u.Status = ShareExpired
+		case u.RemainingDownloads != nil && *u.RemainingDownloads == 0:
+			u.Status = ShareExhausted
+		}
+		out = append(out, u)
+	}
+	return out
+}
+
+// RemainingDownloads returns how many more downloads a link allows; nil means no limit
+func RemainingDownloads(l *models.ShareLink) *int {
+	if l.MaxDownloads == nil {
+		return nil
+	}
+	remaining := *l.MaxDownloads - l.Downloads
+	if remaining < 0 {
+		remaining = 0
+	}
+	return &remaining
+}
+
+// NewLinkSecret returns a random secret for a link whose key travels in the URL fragment
+func NewLinkSecret() (string, error) {
+	return generateToken(32)
+}
+
+// hashToken returns the hex SHA-256 under which a link's token is stored
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
 
 func generateToken(n int) (string, error) {
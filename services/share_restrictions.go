@@ -0,0 +1,194 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"file_project/models"
+)
+
+// Reasons a share link refuses a download
+const (
+	DenyNotFound       = "not_found"
+	DenyUnavailable    = "file_unavailable"
+	DenyQuarantined    = "file_quarantined"
+	DenyInvalid        = "link_invalid"
+	DenyDisabled       = "link_disabled"
+	DenyExpired        = "link_expired"
+	DenyLimitReached   = "download_limit_reached"
+	DenyNotYetValid    = "not_yet_valid"
+	DenyIPNotAllowed   = "ip_not_allowed"
+	DenyDayNotAllowed  = "day_not_allowed"
+	DenyHourNotAllowed = "hour_not_allowed"
+	DenyOriginMissing  = "origin_required"
+	DenyOriginInvalid  = "origin_not_allowed"
+)
+
+var ErrInvalidRestriction = errors.New("invalid restriction")
+
+var weekdayNames = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// ShareDenied explains why a share link refused a download
+type ShareDenied struct {
+	Reason  string
+	Message string
+}
+
+func (e *ShareDenied) Error() string {
+	return e.Message
+}
+
+func denied(reason, message string) *ShareDenied {
+	return &ShareDenied{Reason: reason, Message: message}
+}
+
+// AccessRequest describes the request a share link is used from
+type AccessRequest struct {
+	IP        string
+	Origin    string
+	Referer   string
+	UserAgent string
+	Action    string // recorded in the access log, e.g. models.ShareActionDownload
+	Now       time.Time
+}
+
+// normalizeRestrictions validates r and brings it into canonical form: CIDRs with a prefix length,
+// lower-case weekday names and origins reduced to scheme://host[:port].
+func normalizeRestrictions(r *models.ShareRestrictions) error {
+	for i, c := range r.AllowedCIDRs {
+		c = strings.TrimSpace(c)
+		if ip := net.ParseIP(c); ip != nil {
+			bits := 128
+			if ip.To4() != nil {
+				bits = 32
+			}
+			c = fmt.Sprintf("%s/%d", ip, bits)
+		}
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			return fmt.Errorf("%w: %q is not an IP address or CIDR range", ErrInvalidRestriction, r.AllowedCIDRs[i])
+		}
+		r.AllowedCIDRs[i] = n.String()
+	}
+	for i, d := range r.AllowedWeekdays {
+		d = strings.ToLower(strings.TrimSpace(d))
+		if len(d) > 3 {
+			d = d[:3]
+		}
+		if weekdayIndex(d) < 0 {
+			return fmt.Errorf("%w: %q is not a weekday", ErrInvalidRestriction, r.AllowedWeekdays[i])
+		}
+		r.AllowedWeekdays[i] = d
+	}
+	if (r.HoursFrom == nil) != (r.HoursTo == nil) {
+		return fmt.Errorf("%w: hours_from and hours_to must be given together", ErrInvalidRestriction)
+	}
+	if r.HoursFrom != nil && (*r.HoursFrom < 0 || *r.HoursFrom > 23 || *r.HoursTo < 0 || *r.HoursTo > 24 || *r.HoursFrom == *r.HoursTo) {
+		return fmt.Errorf("%w: hours_from must be 0-23 and hours_to 0-24, and they must differ", ErrInvalidRestriction)
+	}
+	if r.TimeZone != "" {
+		if _, err := time.LoadLocation(r.TimeZone); err != nil {
+			return fmt.Errorf("%w: unknown time_zone %q", ErrInvalidRestriction, r.TimeZone)
+		}
+	}
+	for i, o := range r.AllowedOrigins {
+		origin, ok := originOf(strings.TrimSpace(o))
+		if !ok {
+			return fmt.Errorf("%w: %q is not an origin such as https://example.com", ErrInvalidRestriction, o)
+		}
+		r.AllowedOrigins[i] = origin
+	}
+	return nil
+}
+
+// checkRestrictions returns why req may not use a link restricted by r, or nil
+func checkRestrictions(r models.ShareRestrictions, req AccessRequest) *ShareDenied {
+	if r.NotBefore != nil && req.Now.Before(*r.NotBefore) {
+		return denied(DenyNotYetValid, "link is not valid before "+r.NotBefore.UTC().Format(time.RFC3339))
+	}
+	if len(r.AllowedCIDRs) > 0 && !ipAllowed(r.AllowedCIDRs, req.IP) {
+		return denied(DenyIPNotAllowed, "link cannot be used from this IP address")
+	}
+	loc := time.UTC
+	if r.TimeZone != "" {
+		if l, err := time.LoadLocation(r.TimeZone); err == nil {
+			loc = l
+		}
+	}
+	local := req.Now.In(loc)
+	if len(r.AllowedWeekdays) > 0 {
+		day := weekdayNames[local.Weekday()]
+		allowed := false
+		for _, d := range r.AllowedWeekdays {
+			allowed = allowed || d == day
+		}
+		if !allowed {
+			return denied(DenyDayNotAllowed, "link cannot be used on "+local.Weekday().String())
+		}
+	}
+	if r.HoursFrom != nil && r.HoursTo != nil {
+		h, from, to := local.Hour(), *r.HoursFrom, *r.HoursTo
+		inside := h >= from && h < to
+		if from > to {
+			inside = h >= from || h < to
+		}
+		if !inside {
+			return denied(DenyHourNotAllowed, fmt.Sprintf("link can only be used between %02d:00 and %02d:00 %s", from, to, loc))
+		}
+	}
+	if len(r.AllowedOrigins) > 0 {
+		origin, ok := originOf(req.Origin)
+		if !ok {
+			origin, ok = originOf(req.Referer)
+		}
+		if !ok {
+			return denied(DenyOriginMissing, "link requires an Origin or Referer header")
+		}
+		allowed := false
+		for _, o := range r.AllowedOrigins {
+			allowed = allowed || o == origin
+		}
+		if !allowed {
+			return denied(DenyOriginInvalid, "link cannot be used from "+origin)
+		}
+	}
+	return nil
+}
+
+func ipAllowed(cidrs []string, addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, c := range cidrs {
+		if _, n, err := net.ParseCIDR(c); err == nil && n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func weekdayIndex(day string) int {
+	for i, d := range weekdayNames {
+		if d == day {
+			return i
+		}
+	}
+	return -1
+}
+
+// originOf reduces an Origin header, Referer or configured origin to lower-case scheme://host[:port]
+func originOf(raw string) (string, bool) {
+	if raw == "" || raw == "null" {
+		return "", false
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", false
+	}
+	return strings.ToLower(u.Scheme + "://" + u.Host), true
+}
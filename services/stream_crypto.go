@@ -0,0 +1,346 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"os"
+)
+
+// Stream format (used for every blob written since streaming downloads were introduced):
+//
+//	[magic "FPS1"(4)][salt(16)][nonce prefix(7)] then chunks of [ciphertext(<=64KiB)+tag(16)]
+//
+// Each chunk is sealed with AES-256-GCM under nonce = prefix || big-endian chunk counter(4) || last flag(1),
+// with the header as additional data, so chunks cannot be reordered, dropped or truncated at a chunk boundary.
+// Blobs without the magic are in the legacy single-shot format handled by EncryptBytes/DecryptBytes.
+const (
+	streamMagic       = "FPS1"
+	streamPrefixSize  = 7
+	streamHeaderSize  = len(streamMagic) + saltSize + streamPrefixSize
+	streamChunkSize   = 64 * 1024
+	streamTagSize     = 16
+	legacyOverhead    = saltSize + nonceSize + streamTagSize
+	streamSealedChunk = streamChunkSize + streamTagSize
+)
+
+var ErrWrongPassword = errors.New("invalid password or corrupted file")
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func streamNonce(prefix []byte, counter uint32, last bool) []byte {
+	nonce := make([]byte, nonceSize)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[streamPrefixSize:], counter)
+	if last {
+		nonce[nonceSize-1] = 1
+	}
+	return nonce
+}
+
+type encryptWriter struct {
+	dst     io.Writer
+	gcm     cipher.AEAD
+	header  []byte
+	prefix  []byte
+	buf     []byte
+	counter uint32
+	closed  bool
+}
+
+// NewEncryptWriter returns a writer that encrypts everything written to it into dst using the stream format.
+// Close must be called to flush the final chunk; it does not close dst.
+func NewEncryptWriter(dst io.Writer, password string) (io.WriteCloser, error) {
+	header := make([]byte, streamHeaderSize)
+	copy(header, streamMagic)
+	if _, err := io.ReadFull(rand.Reader, header[len(streamMagic):]); err != nil {
+		return nil, err
+	}
+	salt := header[len(streamMagic) : len(streamMagic)+saltSize]
+	key, err := DeriveKey(password, salt)
+	if err != nil {
+		return nil, err
+	}
+	return newEncryptWriter(dst, header, key)
+}
+
+// newEncryptWriter writes header to dst and seals the chunks that follow under key.
+// The nonce prefix is the last streamPrefixSize bytes of the header.
+func newEncryptWriter(dst io.Writer, header, key []byte) (*encryptWriter, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dst.Write(header); err != nil {
+		return nil, err
+	}
+	return &encryptWriter{
+		dst:    dst,
+		gcm:    gcm,
+		header: header,
+		prefix: header[len(header)-streamPrefixSize:],
+		buf:    make([]byte, 0, streamChunkSize),
+	}, nil
+}
+
+func (w *encryptWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errors.New("write on closed encrypt writer")
+	}
+	n := 0
+	for len(p) > 0 {
+		// only seal a full chunk once more data arrives, so the final chunk can carry the last flag
+		if len(w.buf) == streamChunkSize {
+			if err := w.seal(false); err != nil {
+				return n, err
+			}
+		}
+		k := copy(w.buf[len(w.buf):streamChunkSize], p)
+		w.buf = w.buf[:len(w.buf)+k]
+		p = p[k:]
+		n += k
+	}
+	return n, nil
+}
+
+func (w *encryptWriter) seal(last bool) error {
+	out := w.gcm.Seal(nil, streamNonce(w.prefix, w.counter, last), w.buf, w.header)
+	if _, err := w.dst.Write(out); err != nil {
+		return err
+	}
+	w.counter++
+	w.buf = w.buf[:0]
+	return nil
+}
+
+func (w *encryptWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	return w.seal(true)
+}
+
+type decryptReader struct {
+	src     *bufio.Reader
+	gcm     cipher.AEAD
+	header  []byte
+	prefix  []byte
+	chunk   []byte
+	plain   []byte
+	counter uint32
+	done    bool
+}
+
+// newDecryptReader reads the stream header from src and eagerly decrypts the first chunk,
+// so a wrong password is reported before any plaintext is handed out.
+func newDecryptReader(src io.Reader, password string) (*decryptReader, error) {
+	br := bufio.NewReaderSize(src, streamSealedChunk+1)
+	header := make([]byte, streamHeaderSize)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return nil, ErrWrongPassword
+	}
+	if string(header[:len(streamMagic)]) != streamMagic {
+		return nil, errors.New("not a stream blob")
+	}
+	key, err := DeriveKey(password, header[len(streamMagic):len(streamMagic)+saltSize])
+	if err != nil {
+		return nil, err
+	}
+	return openStream(br, header, key)
+}
+
+// openStream decrypts the chunks following an already consumed header under key
+func openStream(br *bufio.Reader, header, key []byte) (*decryptReader, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	r := &decryptReader{
+		src:    br,
+		gcm:    gcm,
+		header: header,
+		prefix: header[len(header)-streamPrefixSize:],
+		chunk:  make([]byte, streamSealedChunk),
+	}
+	if err := r.next(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// next decrypts the following chunk into r.plain
+func (r *decryptReader) next() error {
+	n, err := io.ReadFull(r.src, r.chunk)
+	last := false
+	switch {
+	case err == io.ErrUnexpectedEOF || err == io.EOF:
+		last = true
+	case err != nil:
+		return err
+	default:
+		if _, perr := r.src.Peek(1); perr == io.EOF {
+			last = true
+		}
+	}
+	if n < streamTagSize {
+		return ErrWrongPassword
+	}
+	plain, err := r.gcm.Open(r.chunk[:0], streamNonce(r.prefix, r.counter, last), r.chunk[:n], r.header)
+	if err != nil {
+		return ErrWrongPassword
+	}
+	r.plain = plain
+	r.counter++
+	r.done = last
+	return nil
+}
+
+func (r *decryptReader) Read(p []byte) (int, error) {
+	for len(r.plain) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if err := r.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.plain)
+	r.plain = r.plain[n:]
+	return n, nil
+}
+
+type blobReader struct {
+	io.Reader
+	closer io.Closer
+}
+
+func (b *blobReader) Close() error {
+	if b.closer == nil {
+		return nil
+	}
+	return b.closer.Close()
+}
+
+// OpenBlob opens an encrypted blob on disk and returns a reader of its plaintext.
+// Stream-format blobs are decrypted chunk by chunk; legacy blobs are decrypted in memory.
+// The password is checked before OpenBlob returns.
+func OpenBlob(path, password string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	magic := make([]byte, len(streamMagic))
+	if _, err := io.ReadFull(f, magic); err == nil && string(magic) == streamMagic {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			f.Close()
+			return nil, err
+		}
+		r, err := newDecryptReader(f, password)
+		if err == nil {
+			return &blobReader{Reader: r, closer: f}, nil
+		}
+		// a legacy salt may start with the magic by chance; fall through and try the legacy format
+	}
+	defer f.Close()
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	enc, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := DecryptBytes(enc, password)
+	if err != nil {
+		return nil, ErrWrongPassword
+	}
+	return &blobReader{Reader: bytes.NewReader(plain)}, nil
+}
+
+// EncryptToFile streams src into a new stream-format blob at path.
+// It returns the stored size and the hex SHA-256 of the ciphertext as written.
+func EncryptToFile(path string, src io.Reader, password string) (int64, string, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return 0, "", err
+	}
+	cw := newCountingWriter(f)
+	ew, err := NewEncryptWriter(cw, password)
+	if err == nil {
+		if _, err = io.Copy(ew, src); err == nil {
+			err = ew.Close()
+		}
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(path)
+		return 0, "", err
+	}
+	return cw.n, cw.Sum(), nil
+}
+
+// PlaintextSize computes the original size of a blob from its stored size and format
+func PlaintextSize(path string) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	magic := make([]byte, len(streamMagic))
+	if _, err := io.ReadFull(f, magic); err == nil {
+		switch string(magic) {
+		case streamMagic:
+			return chunkedPlaintextSize(st.Size() - int64(streamHeaderSize)), nil
+		case envelopeMagic:
+			return chunkedPlaintextSize(st.Size() - int64(envelopeHeaderSize)), nil
+		}
+	}
+	return st.Size() - legacyOverhead, nil
+}
+
+func chunkedPlaintextSize(body int64) int64 {
+	chunks := (body + streamSealedChunk - 1) / streamSealedChunk
+	return body - chunks*streamTagSize
+}
+
+// countingWriter counts and hashes everything written through it
+type countingWriter struct {
+	w io.Writer
+	h hash.Hash
+	n int64
+}
+
+func newCountingWriter(w io.Writer) *countingWriter {
+	return &countingWriter{w: w, h: sha256.New()}
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.h.Write(p[:n])
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countingWriter) Sum() string {
+	return hex.EncodeToString(c.h.Sum(nil))
+}